@@ -0,0 +1,179 @@
+// Command ratelimiter runs the rate limiting reverse proxy as a standalone binary
+// It is configured with flags, environment variables or a config file, e.g.
+//
+//	ratelimiter -target http://localhost:3000 -header X-API-Key -capacity 20 -refill-rate 5
+//	ratelimiter -config ratelimiter.yaml -listen :8443 -tls-cert cert.pem -tls-key key.pem
+//
+// With a config file the config is reloaded on SIGHUP and whenever the file changes.
+// SIGINT and SIGTERM stop the proxy gracefully - in-flight requests are drained first
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/helper"
+	"github.com/krishpatel023/ratelimiter/limiters"
+)
+
+func main() {
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err := run(opts); err != nil {
+		helper.Log(err.Error(), "error")
+		os.Exit(1)
+	}
+}
+
+// run starts the proxy and blocks until it is stopped
+func run(opts options) error {
+	file, err := opts.fileConfig()
+	if err != nil {
+		return err
+	}
+
+	handler, stopLimiter, err := newHandler(opts, file)
+	if err != nil {
+		return err
+	}
+	defer stopLimiter()
+
+	// A config file is reloaded on SIGHUP and when it changes
+	if opts.configPath != "" {
+		defer handler.ReloadOnSignal()()
+		defer handler.WatchFile(opts.configPath, opts.watchInterval)()
+	}
+
+	server := &http.Server{
+		Addr:         opts.listen,
+		Handler:      handler,
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+		IdleTimeout:  opts.idleTimeout,
+	}
+	servers := []*http.Server{server}
+
+	// The admin server exposes the reload endpoint away from the proxied traffic
+	if opts.adminListen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/reload", handler.ReloadHandler())
+		servers = append(servers, &http.Server{
+			Addr:              opts.adminListen,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		})
+	}
+
+	// The signals are caught before the listeners start, so a SIGTERM right after startup still drains the servers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, proxy bool) {
+			var err error
+			if proxy && opts.tlsCert != "" {
+				helper.Log("Rate limiter listening on "+srv.Addr+" (TLS)", "info")
+				err = srv.ListenAndServeTLS(opts.tlsCert, opts.tlsKey)
+			} else {
+				helper.Log("Listening on "+srv.Addr, "info")
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}(srv, i == 0)
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		helper.Log("Shutting down - draining in-flight requests", "info")
+	case serveErr = <-errs:
+	}
+
+	// Stop accepting requests and wait for the proxied ones to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			helper.Log("Failed to drain "+srv.Addr+": "+err.Error(), "error")
+		}
+	}
+
+	if serveErr != nil {
+		return fmt.Errorf("server failed: %w", serveErr)
+	}
+	helper.Log("Rate limiter stopped", "info")
+	return nil
+}
+
+// newHandler creates the rate limiter of the backend and its reloadable middleware
+// The returned function stops the rate limiter
+func newHandler(opts options, file limiters.FileConfig) (*limiters.ReloadableHandler, func(), error) {
+	if file.Backend == limiters.DistributedBackend {
+		config, err := file.DistributedConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		rl, err := limiters.CreateDistributedRateLimiter(config)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var reload func() (limiters.DistributedRateLimiterConfig, error)
+		if opts.configPath != "" {
+			reload = limiters.DistributedConfigLoader(opts.configPath)
+		}
+		handler, err := limiters.DistributedReloadableMiddleware(rl, firstThen(config, reload))
+		if err != nil {
+			limiters.StopDistributedRateLimiter(rl)
+			return nil, nil, err
+		}
+		return handler, func() { limiters.StopDistributedRateLimiter(rl) }, nil
+	}
+
+	config, err := file.LocalConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	rl, err := limiters.CreateLocalRateLimiter(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reload func() (limiters.LocalRateLimiterConfig, error)
+	if opts.configPath != "" {
+		reload = limiters.LocalConfigLoader(opts.configPath)
+	}
+	handler, err := limiters.LocalReloadableMiddleware(rl, firstThen(config, reload))
+	if err != nil {
+		limiters.StopLocalRateLimiter(rl)
+		return nil, nil, err
+	}
+	return handler, func() { limiters.StopLocalRateLimiter(rl) }, nil
+}
+
+// firstThen returns the config already loaded on the first call and reloads it on the next calls,
+// so the API key file of the config is not loaded twice at startup
+// Without reload the first config is returned every time
+func firstThen[T any](first T, reload func() (T, error)) func() (T, error) {
+	loaded := false
+	return func() (T, error) {
+		if !loaded || reload == nil {
+			loaded = true
+			return first, nil
+		}
+		return reload()
+	}
+}
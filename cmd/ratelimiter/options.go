@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/limiters"
+)
+
+// options holds the command line flags
+// Every flag can also be set with an environment variable, e.g. RATELIMITER_TARGET for -target.
+// Flags take precedence over the environment
+type options struct {
+	configPath    string        // Config file - the limit flags are ignored when set
+	watchInterval time.Duration // How often the config file is checked for changes
+
+	backend    string
+	target     string
+	header     string
+	capacity   int
+	refillRate float64
+	algorithm  string
+	window     time.Duration
+
+	legacyHeaders bool
+
+	redisAddr     string
+	redisPassword string
+	redisDB       int
+	keyPrefix     string
+
+	listen          string
+	adminListen     string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownTimeout time.Duration
+	tlsCert         string
+	tlsKey          string
+}
+
+// parseOptions parses the flags, taking the defaults from the environment
+func parseOptions(args []string) (options, error) {
+	var opts options
+	env := envDefaults{}
+	flags := flag.NewFlagSet("ratelimiter", flag.ContinueOnError)
+
+	flags.StringVar(&opts.configPath, "config", env.string("CONFIG", ""), "YAML, JSON or TOML config file - replaces the limit flags and is reloaded on SIGHUP and on change")
+	flags.DurationVar(&opts.watchInterval, "watch-interval", env.duration("WATCH_INTERVAL", 5*time.Second), "How often the config file is checked for changes")
+
+	flags.StringVar(&opts.backend, "backend", env.string("BACKEND", limiters.LocalBackend), "Rate limiter backend - local or distributed")
+	flags.StringVar(&opts.target, "target", env.string("TARGET", ""), "Target URL the allowed requests are proxied to")
+	flags.StringVar(&opts.header, "header", env.string("HEADER", "X-ID"), "Header identifying the client")
+	flags.IntVar(&opts.capacity, "capacity", env.int("CAPACITY", 20), "Capacity of each bucket")
+	flags.Float64Var(&opts.refillRate, "refill-rate", env.float("REFILL_RATE", 1), "Tokens added to each bucket per second")
+	flags.StringVar(&opts.algorithm, "algorithm", env.string("ALGORITHM", string(limiters.TokenBucket)), "Rate limiting algorithm - token-bucket, gcra, sliding-window-log, sliding-window-counter or fixed-window")
+	flags.DurationVar(&opts.window, "window", env.duration("WINDOW", time.Minute), "Window of the window based algorithms")
+
+	flags.BoolVar(&opts.legacyHeaders, "legacy-headers", env.bool("LEGACY_HEADERS", false), "Also send the X-RateLimit-* headers")
+
+	flags.StringVar(&opts.redisAddr, "redis-addr", env.string("REDIS_ADDR", "localhost:6379"), "Redis address of the distributed backend")
+	flags.StringVar(&opts.redisPassword, "redis-password", env.string("REDIS_PASSWORD", ""), "Redis password - prefer RATELIMITER_REDIS_PASSWORD")
+	flags.IntVar(&opts.redisDB, "redis-db", env.int("REDIS_DB", 0), "Redis DB number")
+	flags.StringVar(&opts.keyPrefix, "key-prefix", env.string("KEY_PREFIX", "ratelimit"), "Redis key prefix")
+
+	flags.StringVar(&opts.listen, "listen", env.string("LISTEN", ":8080"), "Address the proxy listens on")
+	flags.StringVar(&opts.adminListen, "admin-listen", env.string("ADMIN_LISTEN", ""), "Address of the admin server with POST /reload - disabled when empty")
+	flags.DurationVar(&opts.readTimeout, "read-timeout", env.duration("READ_TIMEOUT", 15*time.Second), "Maximum time to read a request")
+	flags.DurationVar(&opts.writeTimeout, "write-timeout", env.duration("WRITE_TIMEOUT", 60*time.Second), "Maximum time to write a response, including the proxied request")
+	flags.DurationVar(&opts.idleTimeout, "idle-timeout", env.duration("IDLE_TIMEOUT", 120*time.Second), "Maximum time an idle keep-alive connection is kept")
+	flags.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", env.duration("SHUTDOWN_TIMEOUT", 30*time.Second), "Maximum time to drain the in-flight requests on shutdown")
+	flags.StringVar(&opts.tlsCert, "tls-cert", env.string("TLS_CERT", ""), "TLS certificate file - serves HTTPS together with -tls-key")
+	flags.StringVar(&opts.tlsKey, "tls-key", env.string("TLS_KEY", ""), "TLS key file")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if len(env) > 0 {
+		return opts, fmt.Errorf("invalid environment variables: %s", strings.Join(env, ", "))
+	}
+
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		return opts, fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	if opts.watchInterval <= 0 || opts.shutdownTimeout <= 0 {
+		return opts, fmt.Errorf("-watch-interval and -shutdown-timeout must be greater than zero")
+	}
+	return opts, nil
+}
+
+// fileConfig returns the config file, or a config built from the flags when there is none
+// Both are validated the same way
+func (opts options) fileConfig() (limiters.FileConfig, error) {
+	if opts.configPath != "" {
+		return limiters.LoadConfigFile(opts.configPath)
+	}
+
+	window := limiters.Duration(opts.window)
+	file := limiters.FileConfig{
+		Backend:    opts.backend,
+		TargetURL:  opts.target,
+		Capacity:   &opts.capacity,
+		RefillRate: &opts.refillRate,
+		Algorithm:  opts.algorithm,
+		Window:     &window,
+		Key:        limiters.KeyFileConfig{Header: opts.header},
+		Headers:    limiters.HeadersFileConfig{Legacy: opts.legacyHeaders},
+		Redis: limiters.RedisFileConfig{
+			Address:   opts.redisAddr,
+			Password:  opts.redisPassword,
+			DB:        opts.redisDB,
+			KeyPrefix: opts.keyPrefix,
+		},
+	}
+	if err := file.Validate(); err != nil {
+		return file, fmt.Errorf("flags: %w", err)
+	}
+	return file, nil
+}
+
+// envDefaults reads the flag defaults from RATELIMITER_* environment variables
+// and collects the variables that cannot be parsed
+type envDefaults []string
+
+func (env *envDefaults) lookup(name string) (string, bool) {
+	return os.LookupEnv("RATELIMITER_" + name)
+}
+
+func (env *envDefaults) string(name, defaultValue string) string {
+	if value, ok := env.lookup(name); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (env *envDefaults) int(name string, defaultValue int) int {
+	if value, ok := env.lookup(name); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			*env = append(*env, "RATELIMITER_"+name)
+			return defaultValue
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+func (env *envDefaults) float(name string, defaultValue float64) float64 {
+	if value, ok := env.lookup(name); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			*env = append(*env, "RATELIMITER_"+name)
+			return defaultValue
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+func (env *envDefaults) bool(name string, defaultValue bool) bool {
+	if value, ok := env.lookup(name); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			*env = append(*env, "RATELIMITER_"+name)
+			return defaultValue
+		}
+		return parsed
+	}
+	return defaultValue
+}
+
+func (env *envDefaults) duration(name string, defaultValue time.Duration) time.Duration {
+	if value, ok := env.lookup(name); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			*env = append(*env, "RATELIMITER_"+name)
+			return defaultValue
+		}
+		return parsed
+	}
+	return defaultValue
+}
@@ -0,0 +1,33 @@
+package adaptive
+
+func AdjustLuaScript() string {
+	// Lua script for atomic operations
+	// The adjusted refill rate is shared by every instance through a single key.
+	// A missing key means the full rate, so the key is removed once the rate is back to it.
+	// It applies a tally of responses at once like Next - the healthy ones add their steps first.
+	// The rate is returned as a string since Lua numbers are truncated to integers in replies
+	script := `
+	local rate_key = KEYS[1]
+	local healthy = tonumber(ARGV[1])
+	local unhealthy = tonumber(ARGV[2])
+	local max_rate = tonumber(ARGV[3])
+	local min_rate = tonumber(ARGV[4])
+	local decrease_factor = tonumber(ARGV[5])
+	local increase_step = tonumber(ARGV[6])
+	local expiration = tonumber(ARGV[7])
+
+	local rate = tonumber(redis.call('GET', rate_key)) or max_rate
+
+	rate = math.min(max_rate, rate + increase_step * healthy)
+	rate = math.max(min_rate, rate * decrease_factor ^ unhealthy)
+
+	if rate >= max_rate then
+		redis.call('DEL', rate_key)
+	else
+		redis.call('SET', rate_key, rate, 'PX', expiration)
+	end
+
+	return tostring(rate)
+	`
+	return script
+}
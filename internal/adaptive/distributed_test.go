@@ -0,0 +1,58 @@
+package adaptive
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAdjust(t *testing.T) {
+	settings := Settings{MaxRate: 10, MinRate: 1, DecreaseFactor: 0.5, IncreaseStep: 0.5}
+
+	tests := []struct {
+		name  string
+		rate  float64 // Rate before the tally - the Redis key is missing at MaxRate
+		tally Tally
+		want  float64
+	}{
+		{name: "healthy responses add their steps", rate: 4, tally: Tally{Healthy: 3}, want: 5.5},
+		{name: "steps stop at the max rate", rate: 9, tally: Tally{Healthy: 5}, want: 10},
+		{name: "unhealthy responses decrease once each", rate: 10, tally: Tally{Unhealthy: 2}, want: 2.5},
+		{name: "decrease stops at the min rate", rate: 4, tally: Tally{Unhealthy: 10}, want: 1},
+		{name: "failures end on a decreased rate", rate: 8, tally: Tally{Healthy: 4, Unhealthy: 1}, want: 5},
+		{name: "empty tally keeps the rate", rate: 3, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Next(tt.rate, tt.tally, settings); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+			if tt.rate < settings.MaxRate {
+				server.Set("rate", strconv.FormatFloat(tt.rate, 'f', -1, 64))
+			}
+
+			args := []interface{}{tt.tally.Healthy, tt.tally.Unhealthy, settings.MaxRate, settings.MinRate, settings.DecreaseFactor, settings.IncreaseStep, 60000}
+			got, err := client.Eval(context.Background(), AdjustLuaScript(), []string{"rate"}, args...).Float64()
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("script = %v, want %v", got, tt.want)
+			}
+
+			// The key is gone at the max rate
+			if exists := server.Exists("rate"); exists != (tt.want < settings.MaxRate) {
+				t.Errorf("key exists = %v at rate %v", exists, tt.want)
+			}
+		})
+	}
+}
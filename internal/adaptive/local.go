@@ -0,0 +1,25 @@
+package adaptive
+
+import "math"
+
+// Settings holds the bounds and steps of the AIMD (additive increase, multiplicative decrease) refill rate
+type Settings struct {
+	MaxRate        float64 // Refill rate when the target is healthy
+	MinRate        float64 // Lowest refill rate
+	DecreaseFactor float64 // Multiplier applied on an unhealthy response
+	IncreaseStep   float64 // Tokens per second added back on a healthy response
+}
+
+// Tally counts the healthy and unhealthy responses of the target since the last adjustment
+type Tally struct {
+	Healthy   int // Responses that add IncreaseStep
+	Unhealthy int // Responses that apply DecreaseFactor
+}
+
+// Next returns the refill rate following rate after the responses of the tally
+// The healthy responses add their steps first and every unhealthy one applies the decrease after,
+// so a tally with failures ends on a decreased rate
+func Next(rate float64, tally Tally, s Settings) float64 {
+	rate = min(s.MaxRate, rate+s.IncreaseStep*float64(tally.Healthy))
+	return max(s.MinRate, rate*math.Pow(s.DecreaseFactor, float64(tally.Unhealthy)))
+}
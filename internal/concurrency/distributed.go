@@ -0,0 +1,68 @@
+package concurrency
+
+func AcquireLuaScript() string {
+	// Lua script for atomic operations
+	// In-flight requests are leases in two sorted sets - one for the key and one shared by all
+	// the keys - scored by the time the lease expires in milliseconds. Expired leases are dropped
+	// before counting, so the slots of a crashed instance come back once their lease runs out.
+	// A limit of zero means no limit
+	script := `
+	local key_leases = KEYS[1]
+	local global_leases = KEYS[2]
+	local lease_id = ARGV[1]
+	local per_key_limit = tonumber(ARGV[2])
+	local global_limit = tonumber(ARGV[3])
+	local lease_time = tonumber(ARGV[4])
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+	-- Drop the leases that expired
+	redis.call('ZREMRANGEBYSCORE', key_leases, '-inf', now)
+	redis.call('ZREMRANGEBYSCORE', global_leases, '-inf', now)
+
+	if per_key_limit > 0 and redis.call('ZCARD', key_leases) >= per_key_limit then
+		return 0
+	end
+	if global_limit > 0 and redis.call('ZCARD', global_leases) >= global_limit then
+		return 0
+	end
+
+	redis.call('ZADD', key_leases, now + lease_time, lease_id)
+	redis.call('ZADD', global_leases, now + lease_time, lease_id)
+	redis.call('PEXPIRE', key_leases, lease_time)
+	redis.call('PEXPIRE', global_leases, lease_time)
+
+	return 1
+	`
+	return script
+}
+
+func RenewLuaScript() string {
+	// Lua script for atomic operations
+	// It pushes back the expiry of a lease that is still held, so long running
+	// requests keep their slot. A lease that already expired is not brought back
+	script := `
+	local key_leases = KEYS[1]
+	local global_leases = KEYS[2]
+	local lease_id = ARGV[1]
+	local lease_time = tonumber(ARGV[2])
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+	-- Drop the leases that expired, so an expired lease is not renewed
+	redis.call('ZREMRANGEBYSCORE', key_leases, '-inf', now)
+	redis.call('ZREMRANGEBYSCORE', global_leases, '-inf', now)
+
+	if redis.call('ZADD', key_leases, 'XX', 'CH', now + lease_time, lease_id) == 1 then
+		redis.call('PEXPIRE', key_leases, lease_time)
+	end
+	if redis.call('ZADD', global_leases, 'XX', 'CH', now + lease_time, lease_id) == 1 then
+		redis.call('PEXPIRE', global_leases, lease_time)
+	end
+
+	return 1
+	`
+	return script
+}
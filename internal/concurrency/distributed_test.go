@@ -0,0 +1,103 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestConcurrencyLuaScripts(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	lease := 10 * time.Second
+
+	type step struct {
+		at     time.Duration // Time of the step after start
+		script string        // acquire or renew
+		key    string
+		lease  string
+		want   int
+	}
+	tests := []struct {
+		name   string
+		perKey int
+		global int
+		steps  []step
+	}{
+		{
+			name:   "per key limit",
+			perKey: 1,
+			steps: []step{
+				{script: "acquire", key: "a", lease: "1", want: 1},
+				{script: "acquire", key: "a", lease: "2", want: 0},
+				{script: "acquire", key: "b", lease: "3", want: 1},
+			},
+		},
+		{
+			name:   "global limit",
+			global: 2,
+			steps: []step{
+				{script: "acquire", key: "a", lease: "1", want: 1},
+				{script: "acquire", key: "b", lease: "2", want: 1},
+				{script: "acquire", key: "c", lease: "3", want: 0},
+			},
+		},
+		{
+			name:   "expired lease frees its slot",
+			perKey: 1,
+			steps: []step{
+				{script: "acquire", key: "a", lease: "1", want: 1},
+				{at: lease - time.Millisecond, script: "acquire", key: "a", lease: "2", want: 0},
+				{at: lease, script: "acquire", key: "a", lease: "3", want: 1},
+			},
+		},
+		{
+			name:   "renewed lease keeps its slot",
+			perKey: 1,
+			steps: []step{
+				{script: "acquire", key: "a", lease: "1", want: 1},
+				{at: lease / 2, script: "renew", key: "a", lease: "1", want: 1},
+				{at: lease, script: "acquire", key: "a", lease: "2", want: 0},
+				{at: lease + lease/2, script: "acquire", key: "a", lease: "3", want: 1},
+			},
+		},
+		{
+			name:   "expired lease is not renewed",
+			perKey: 1,
+			steps: []step{
+				{script: "acquire", key: "a", lease: "1", want: 1},
+				{at: lease, script: "renew", key: "a", lease: "1", want: 1},
+				{at: lease, script: "acquire", key: "a", lease: "2", want: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			for i, step := range tt.steps {
+				server.SetTime(start.Add(step.at))
+				keys := []string{step.key + ":concurrency", "concurrency"}
+
+				var got int
+				var err error
+				if step.script == "renew" {
+					got, err = client.Eval(context.Background(), RenewLuaScript(), keys, step.lease, lease.Milliseconds()).Int()
+				} else {
+					got, err = client.Eval(context.Background(), AcquireLuaScript(), keys, step.lease, tt.perKey, tt.global, lease.Milliseconds()).Int()
+				}
+				if err != nil {
+					t.Fatalf("step %d: Eval: %v", i, err)
+				}
+				if got != step.want {
+					t.Fatalf("step %d: %s of lease %s on key %s = %d, want %d", i, step.script, step.lease, step.key, got, step.want)
+				}
+			}
+		})
+	}
+}
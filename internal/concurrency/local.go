@@ -0,0 +1,49 @@
+package concurrency
+
+import "sync"
+
+// Semaphore counts the in-flight requests of every key and of all the keys together
+type Semaphore struct {
+	mu       sync.Mutex
+	inFlight map[string]int // In-flight requests per key - keys without requests are removed
+	total    int            // In-flight requests across all the keys
+}
+
+func NewSemaphore() *Semaphore {
+	return &Semaphore{
+		inFlight: make(map[string]int),
+	}
+}
+
+// Acquire takes a slot for the key if neither the key nor the total is at its limit
+// A limit of zero or less means no limit
+func (s *Semaphore) Acquire(id string, perKey, global int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if perKey > 0 && s.inFlight[id] >= perKey {
+		return false
+	}
+	if global > 0 && s.total >= global {
+		return false
+	}
+
+	s.inFlight[id]++
+	s.total++
+	return true
+}
+
+// Release gives back a slot taken by Acquire
+func (s *Semaphore) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inFlight[id] <= 1 {
+		delete(s.inFlight, id)
+	} else {
+		s.inFlight[id]--
+	}
+	if s.total > 0 {
+		s.total--
+	}
+}
@@ -0,0 +1,69 @@
+package concurrency
+
+import "testing"
+
+func TestSemaphore(t *testing.T) {
+	type step struct {
+		release bool // Give back a slot of the key instead of taking one
+		id      string
+		want    bool
+	}
+	tests := []struct {
+		name   string
+		perKey int
+		global int
+		steps  []step
+	}{
+		{
+			name:   "per key limit",
+			perKey: 2,
+			steps:  []step{{id: "a", want: true}, {id: "a", want: true}, {id: "a", want: false}, {id: "b", want: true}},
+		},
+		{
+			name:   "global limit",
+			global: 2,
+			steps:  []step{{id: "a", want: true}, {id: "b", want: true}, {id: "c", want: false}},
+		},
+		{
+			name:   "released slot is taken again",
+			perKey: 1,
+			global: 2,
+			steps: []step{
+				{id: "a", want: true}, {id: "a", want: false},
+				{release: true, id: "a"}, {id: "a", want: true},
+				{id: "b", want: true}, {id: "c", want: false},
+				{release: true, id: "b"}, {id: "c", want: true},
+			},
+		},
+		{
+			name:  "no limits",
+			steps: []step{{id: "a", want: true}, {id: "a", want: true}, {id: "b", want: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSemaphore()
+			for i, step := range tt.steps {
+				if step.release {
+					s.Release(step.id)
+					continue
+				}
+				if got := s.Acquire(step.id, tt.perKey, tt.global); got != step.want {
+					t.Fatalf("step %d: Acquire(%q) = %v, want %v", i, step.id, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSemaphoreReleaseForgetsIdleKeys(t *testing.T) {
+	s := NewSemaphore()
+	s.Acquire("a", 1, 0)
+	s.Release("a")
+	s.Release("a") // A second release of the same key takes nothing below zero
+
+	if len(s.inFlight) != 0 || s.total != 0 {
+		t.Errorf("in flight = %v with a total of %d, want nothing", s.inFlight, s.total)
+	}
+}
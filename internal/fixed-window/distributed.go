@@ -0,0 +1,39 @@
+package fixed_window
+
+func FixedWindowLuaScript() string {
+	// Lua script for atomic operations
+	// Every window has its own counter key, named after the start of the window by the caller.
+	// The counter is created by INCRBY and set to expire at the end of the window with EXPIREAT.
+	// Rejected requests are taken back out so they do not count against the window.
+	// The caller works out the window from its own clock, so a window that does not hold the time of
+	// Redis is left alone and {-1, now} is returned instead - the caller retries with the time of Redis.
+	// Times are returned in microseconds: {allowed, remaining, retry_after, reset_after}
+	script := `
+	local window_key = KEYS[1]
+	local tokens_requested = tonumber(ARGV[1])
+	local limit = tonumber(ARGV[2])
+	local window_end = tonumber(ARGV[3])
+	local window_start = tonumber(ARGV[4])
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+	if now < window_start * 1000000 or now >= window_end * 1000000 then
+		return {-1, now, 0, 0}
+	end
+
+	local count = redis.call('INCRBY', window_key, tokens_requested)
+	if count == tokens_requested then
+		redis.call('EXPIREAT', window_key, window_end)
+	end
+
+	local reset_after = math.max(0, window_end * 1000000 - now)
+
+	if count > limit then
+		count = redis.call('DECRBY', window_key, tokens_requested)
+		return {0, math.max(0, limit - count), reset_after, reset_after}
+	end
+
+	return {1, limit - count, 0, reset_after}
+	`
+	return script
+}
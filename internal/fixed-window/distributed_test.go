@@ -0,0 +1,118 @@
+package fixed_window
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFixedWindowLuaScript(t *testing.T) {
+	windowEnd := time.Unix(1700000040, 0)
+
+	tests := []struct {
+		name   string
+		limit  int
+		before []int         // Tokens of the requests allowed before
+		left   time.Duration // Time left in the window when the request is checked
+		tokens int
+		want   []int64 // {allowed, remaining, retry_after, reset_after} in microseconds
+	}{
+		{
+			name:   "empty window",
+			limit:  3,
+			left:   30 * time.Second,
+			tokens: 1,
+			want:   []int64{1, 2, 0, (30 * time.Second).Microseconds()},
+		},
+		{
+			name:   "last slot",
+			limit:  3,
+			before: []int{2},
+			left:   10 * time.Second,
+			tokens: 1,
+			want:   []int64{1, 0, 0, (10 * time.Second).Microseconds()},
+		},
+		{
+			name:   "full window waits for the next one",
+			limit:  3,
+			before: []int{1, 2},
+			left:   10 * time.Second,
+			tokens: 1,
+			want:   []int64{0, 0, (10 * time.Second).Microseconds(), (10 * time.Second).Microseconds()},
+		},
+		{
+			name:   "rejected request is not counted",
+			limit:  5,
+			before: []int{3},
+			left:   1500 * time.Millisecond,
+			tokens: 3,
+			want:   []int64{0, 2, (1500 * time.Millisecond).Microseconds(), (1500 * time.Millisecond).Microseconds()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			server.SetTime(windowEnd.Add(-tt.left))
+			run := func(tokens int) []int64 {
+				args := []interface{}{tokens, tt.limit, windowEnd.Unix(), windowEnd.Add(-time.Minute).Unix()}
+				values, err := client.Eval(context.Background(), FixedWindowLuaScript(), []string{"window"}, args...).Int64Slice()
+				if err != nil {
+					t.Fatalf("Eval: %v", err)
+				}
+				return values
+			}
+
+			for i, tokens := range tt.before {
+				if values := run(tokens); values[0] != 1 {
+					t.Fatalf("request %d was rejected: %v", i, values)
+				}
+			}
+			got := run(tt.tokens)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			// Only the allowed requests stay in the window
+			count, err := client.Get(context.Background(), "window").Int()
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if want := tt.limit - int(got[1]); count != want {
+				t.Errorf("count = %d, want %d", count, want)
+			}
+		})
+	}
+}
+
+func TestFixedWindowLuaScriptOtherWindow(t *testing.T) {
+	windowEnd := time.Unix(1700000040, 0)
+
+	// The window of the caller does not hold the time of Redis - the time is returned and nothing is counted
+	for _, now := range []time.Time{windowEnd.Add(-time.Minute - time.Millisecond), windowEnd, windowEnd.Add(time.Hour)} {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		server.SetTime(now)
+
+		args := []interface{}{1, 3, windowEnd.Unix(), windowEnd.Add(-time.Minute).Unix()}
+		got, err := client.Eval(context.Background(), FixedWindowLuaScript(), []string{"window"}, args...).Int64Slice()
+		client.Close()
+		if err != nil {
+			t.Fatalf("Eval: %v", err)
+		}
+		if want := []int64{-1, now.UnixMicro(), 0, 0}; len(got) != 4 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("at %v: got %v, want %v", now, got, want)
+		}
+		if keys := server.Keys(); len(keys) != 0 {
+			t.Errorf("at %v: keys = %v, want none", now, keys)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package fixed_window
+
+import (
+	"sync"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/result"
+)
+
+// Unit is a calendar unit windows can be aligned to
+type Unit string
+
+const (
+	Minute Unit = "minute"
+	Hour   Unit = "hour"
+	Day    Unit = "day"
+	Month  Unit = "month"
+)
+
+// Bounds returns the start and the end of the window t falls in
+// With a unit the window is aligned to the calendar of loc - a Day window runs from midnight to midnight.
+// Without one the window is window long and aligned to the Unix epoch
+func Bounds(t time.Time, unit Unit, window time.Duration, loc *time.Location) (time.Time, time.Time) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+
+	switch unit {
+	case Minute:
+		start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		return start, start.Add(time.Minute)
+	case Hour:
+		start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		return start, start.Add(time.Hour)
+	case Day:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	case Month:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		nanos := t.UnixNano()
+		start := time.Unix(0, nanos-nanos%int64(window)).In(loc)
+		return start, start.Add(window)
+	}
+}
+
+// FixedWindow counts requests in fixed windows and resets the count on every window boundary
+type FixedWindow struct {
+	mu        sync.Mutex
+	limit     int            // Maximum number of requests per window
+	unit      Unit           // Calendar unit the windows align to - empty for plain windows
+	window    time.Duration  // Length of the windows when no unit is set
+	location  *time.Location // Time zone of the calendar windows
+	windowEnd time.Time      // End of the current window
+	count     int            // Requests allowed in the current window
+}
+
+func NewFixedWindow(limit int, unit Unit, window time.Duration, location *time.Location) *FixedWindow {
+	return &FixedWindow{
+		limit:    limit,
+		unit:     unit,
+		window:   window,
+		location: location,
+	}
+}
+
+// It will check if the request fits in the current window
+// The window is reset once it is over, so a rejected request can be retried then
+func (fw *FixedWindow) AllowRequest(tokens int) result.Result {
+	return fw.decide(tokens, true)
+}
+
+// Check tells if the request would be allowed without counting it
+func (fw *FixedWindow) Check(tokens int) result.Result {
+	return fw.decide(tokens, false)
+}
+
+// decide checks the request and counts it when it is allowed and take is set
+func (fw *FixedWindow) decide(tokens int, take bool) result.Result {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := time.Now()
+	if !now.Before(fw.windowEnd) {
+		_, fw.windowEnd = Bounds(now, fw.unit, fw.window, fw.location)
+		fw.count = 0
+	}
+
+	allowed := fw.count+tokens <= fw.limit
+	if allowed && take {
+		fw.count += tokens
+	}
+
+	res := result.Result{
+		Allowed:    allowed,
+		Limit:      fw.limit,
+		Remaining:  max(0, fw.limit-fw.count),
+		ResetAfter: fw.windowEnd.Sub(now),
+	}
+	if !allowed {
+		res.RetryAfter = res.ResetAfter
+	}
+	return res
+}
+
+// SetLimits changes the number of requests allowed per window
+// The requests already counted stay in the window, the refill rate is not used
+func (fw *FixedWindow) SetLimits(capacity int, refillRate float64) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.limit = capacity
+}
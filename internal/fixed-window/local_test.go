@@ -0,0 +1,144 @@
+package fixed_window
+
+import (
+	"testing"
+	"time"
+)
+
+// within reports if got is within 20ms of want - the window reads the clock itself
+func within(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -20*time.Millisecond && diff < 20*time.Millisecond
+}
+
+func TestBounds(t *testing.T) {
+	utc := time.UTC
+	plus2 := time.FixedZone("UTC+2", 2*60*60)
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		unit      Unit
+		window    time.Duration
+		loc       *time.Location
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "minute",
+			t:         time.Date(2026, 3, 14, 15, 9, 26, 5, utc),
+			unit:      Minute,
+			wantStart: time.Date(2026, 3, 14, 15, 9, 0, 0, utc),
+			wantEnd:   time.Date(2026, 3, 14, 15, 10, 0, 0, utc),
+		},
+		{
+			name:      "hour",
+			t:         time.Date(2026, 3, 14, 15, 9, 26, 0, utc),
+			unit:      Hour,
+			wantStart: time.Date(2026, 3, 14, 15, 0, 0, 0, utc),
+			wantEnd:   time.Date(2026, 3, 14, 16, 0, 0, 0, utc),
+		},
+		{
+			name:      "day in another time zone",
+			t:         time.Date(2026, 3, 14, 23, 30, 0, 0, utc),
+			unit:      Day,
+			loc:       plus2,
+			wantStart: time.Date(2026, 3, 15, 0, 0, 0, 0, plus2),
+			wantEnd:   time.Date(2026, 3, 16, 0, 0, 0, 0, plus2),
+		},
+		{
+			name:      "day defaults to UTC",
+			t:         time.Date(2026, 3, 14, 23, 30, 0, 0, plus2),
+			unit:      Day,
+			wantStart: time.Date(2026, 3, 14, 0, 0, 0, 0, utc),
+			wantEnd:   time.Date(2026, 3, 15, 0, 0, 0, 0, utc),
+		},
+		{
+			name:      "month of February",
+			t:         time.Date(2028, 2, 29, 12, 0, 0, 0, utc),
+			unit:      Month,
+			wantStart: time.Date(2028, 2, 1, 0, 0, 0, 0, utc),
+			wantEnd:   time.Date(2028, 3, 1, 0, 0, 0, 0, utc),
+		},
+		{
+			name:      "plain window aligned to the Unix epoch",
+			t:         time.Unix(1700000000, 0),
+			window:    time.Minute,
+			wantStart: time.Unix(1699999980, 0),
+			wantEnd:   time.Unix(1700000040, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := Bounds(tt.t, tt.unit, tt.window, tt.loc)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Bounds = %v, %v, want %v, %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestFixedWindowAllowRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		count         int           // Requests already counted in the window
+		left          time.Duration // Time left in the current window - the window is over when negative
+		tokens        int
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+	}{
+		{name: "empty window", limit: 3, left: 30 * time.Second, tokens: 1, wantAllowed: true, wantRemaining: 2, wantReset: 30 * time.Second},
+		{name: "last slot", limit: 3, count: 2, left: 30 * time.Second, tokens: 1, wantAllowed: true, wantRemaining: 0, wantReset: 30 * time.Second},
+		{name: "full window", limit: 3, count: 3, left: 30 * time.Second, tokens: 1, wantAllowed: false, wantRemaining: 0, wantReset: 30 * time.Second},
+		{name: "costly request", limit: 5, count: 3, left: 30 * time.Second, tokens: 3, wantAllowed: false, wantRemaining: 2, wantReset: 30 * time.Second},
+		{name: "window is over", limit: 3, count: 3, left: -time.Second, tokens: 1, wantAllowed: true, wantRemaining: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := NewFixedWindow(tt.limit, Hour, 0, time.UTC)
+			fw.count = tt.count
+			fw.windowEnd = time.Now().Add(tt.left)
+
+			res := fw.AllowRequest(tt.tokens)
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Limit != tt.limit || res.Remaining != tt.wantRemaining {
+				t.Errorf("limit, remaining = %d, %d, want %d, %d", res.Limit, res.Remaining, tt.limit, tt.wantRemaining)
+			}
+
+			// A new window runs to the end of the hour
+			wantReset := tt.wantReset
+			if tt.left < 0 {
+				_, end := Bounds(time.Now(), Hour, 0, time.UTC)
+				wantReset = time.Until(end)
+			}
+			if !within(res.ResetAfter, wantReset) {
+				t.Errorf("reset after = %v, want %v", res.ResetAfter, wantReset)
+			}
+			wantRetry := time.Duration(0)
+			if !tt.wantAllowed {
+				wantRetry = wantReset
+			}
+			if !within(res.RetryAfter, wantRetry) {
+				t.Errorf("retry after = %v, want %v", res.RetryAfter, wantRetry)
+			}
+		})
+	}
+}
+
+func TestFixedWindowCheck(t *testing.T) {
+	fw := NewFixedWindow(2, Minute, 0, time.UTC)
+
+	if res := fw.Check(2); !res.Allowed || fw.count != 0 {
+		t.Fatalf("Check allowed = %v with a count of %d, want true with 0", res.Allowed, fw.count)
+	}
+	fw.AllowRequest(1)
+	if res := fw.Check(2); res.Allowed || fw.count != 1 {
+		t.Fatalf("Check allowed = %v with a count of %d, want false with 1", res.Allowed, fw.count)
+	}
+}
@@ -0,0 +1,42 @@
+package gcra
+
+func GCRALuaScript() string {
+	// Lua script for atomic operations
+	// GCRA keeps a single value per key - the theoretical arrival time (TAT) of the next request.
+	// Every token pushes the TAT one emission interval (1 / refill rate) into the future, and a
+	// request is allowed as long as the new TAT is no more than capacity intervals ahead of now.
+	// Times are in microseconds. It returns {allowed, remaining, retry_after, reset_after}
+	script := `
+	local tat_key = KEYS[1]
+	local tokens_requested = tonumber(ARGV[1])
+	local capacity = tonumber(ARGV[2])
+	local refill_rate = tonumber(ARGV[3])
+
+	local emission_interval = 1000000 / refill_rate
+	local tolerance = emission_interval * capacity
+	local increment = emission_interval * tokens_requested
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+	local tat = tonumber(redis.call('GET', tat_key))
+	if not tat or tat < now then
+		tat = now
+	end
+
+	local new_tat = tat + increment
+	local allow_at = new_tat - tolerance
+
+	if now < allow_at then
+		local remaining = math.max(0, math.floor((now - (tat - tolerance)) / emission_interval))
+		return {0, remaining, math.ceil(allow_at - now), math.ceil(tat - now)}
+	end
+
+	local reset_after = new_tat - now
+	redis.call('SET', tat_key, new_tat, 'PX', math.max(1, math.ceil(reset_after / 1000)))
+
+	local remaining = math.floor((now - allow_at) / emission_interval)
+	return {1, remaining, 0, math.ceil(reset_after)}
+	`
+	return script
+}
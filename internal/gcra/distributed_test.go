@@ -0,0 +1,105 @@
+package gcra
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestGCRALuaScript(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	type request struct {
+		at     time.Duration // Time of the request after start
+		tokens int
+	}
+	tests := []struct {
+		name       string
+		capacity   int
+		refillRate string
+		before     []request // Requests allowed before
+		request    request
+		want       []int64 // {allowed, remaining, retry_after, reset_after} in microseconds
+	}{
+		{
+			name:       "first request",
+			capacity:   5,
+			refillRate: "1",
+			request:    request{at: 0, tokens: 1},
+			want:       []int64{1, 4, 0, time.Second.Microseconds()},
+		},
+		{
+			name:       "last request of the burst",
+			capacity:   5,
+			refillRate: "1",
+			before:     []request{{0, 1}, {0, 1}, {0, 1}, {0, 1}},
+			request:    request{at: 0, tokens: 1},
+			want:       []int64{1, 0, 0, (5 * time.Second).Microseconds()},
+		},
+		{
+			name:       "burst used up",
+			capacity:   5,
+			refillRate: "1",
+			before:     []request{{0, 5}},
+			request:    request{at: 0, tokens: 1},
+			want:       []int64{0, 0, time.Second.Microseconds(), (5 * time.Second).Microseconds()},
+		},
+		{
+			name:       "tokens come back at the refill rate",
+			capacity:   5,
+			refillRate: "1",
+			before:     []request{{0, 5}},
+			request:    request{at: 2500 * time.Millisecond, tokens: 1},
+			want:       []int64{1, 1, 0, (3500 * time.Millisecond).Microseconds()},
+		},
+		{
+			name:       "costly request waits for all its tokens",
+			capacity:   5,
+			refillRate: "1",
+			before:     []request{{0, 4}},
+			request:    request{at: 0, tokens: 3},
+			want:       []int64{0, 1, (2 * time.Second).Microseconds(), (4 * time.Second).Microseconds()},
+		},
+		{
+			name:       "fractional refill rate",
+			capacity:   2,
+			refillRate: "0.5",
+			before:     []request{{0, 2}},
+			request:    request{at: time.Second, tokens: 1},
+			want:       []int64{0, 0, time.Second.Microseconds(), (3 * time.Second).Microseconds()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			run := func(req request) []int64 {
+				server.SetTime(start.Add(req.at))
+				args := []interface{}{req.tokens, tt.capacity, tt.refillRate}
+				values, err := client.Eval(context.Background(), GCRALuaScript(), []string{"tat"}, args...).Int64Slice()
+				if err != nil {
+					t.Fatalf("Eval: %v", err)
+				}
+				return values
+			}
+
+			for i, req := range tt.before {
+				if values := run(req); values[0] != 1 {
+					t.Fatalf("request %d was rejected: %v", i, values)
+				}
+			}
+			got := run(tt.request)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
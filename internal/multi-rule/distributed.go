@@ -0,0 +1,200 @@
+package multi_rule
+
+func MultiRuleLuaScript() string {
+	// Lua script for atomic operations
+	// It checks a request against several rules, each with its own key and algorithm, in one go.
+	// The first pass works out the new state of every rule without writing anything and stops at
+	// the first rule without room, so a rejected request is not counted by any rule.
+	// The second pass writes the states of all the rules.
+	// ARGV[1] is the tokens requested and ARGV[2] the sorted set member suffix, then every rule
+	// takes five values: algorithm, capacity, refill rate, window in microseconds and a last value
+	// that is the end of the window for the fixed window and the expiration for the token bucket.
+	// The fixed window is worked out by the caller from its own clock - when it does not hold the
+	// time of Redis nothing is written and {-1, now, 0, 0, rule} is returned for the caller to retry.
+	// It returns {rejected, remaining, retry_after, reset_after, rule} with times in microseconds.
+	// rejected is 0 when the request is allowed, else the position of the rule that rejected it.
+	// The state is the one of the rule that rejected the request, or of the rule with the fewest
+	// tokens left when it is allowed - rule is its position
+	script := `
+	local tokens_requested = tonumber(ARGV[1])
+	local member = ARGV[2]
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+	-- First pass: check every rule
+	local states = {}
+	local tightest = {0, 0, 0, 0, 0}
+	for i, key in ipairs(KEYS) do
+		local base = 2 + (i - 1) * 5
+		local algorithm = ARGV[base + 1]
+		local limit = tonumber(ARGV[base + 2])
+		local refill_rate = tonumber(ARGV[base + 3])
+		local window = tonumber(ARGV[base + 4])
+		local extra = tonumber(ARGV[base + 5])
+
+		local state = {algorithm = algorithm, key = key, window = window, extra = extra}
+		local allowed = false
+		local remaining = 0
+		local retry_after = 0
+		local reset_after = 0
+
+		if algorithm == 'sliding-window-log' then
+			redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+			local count = redis.call('ZCARD', key)
+			allowed = count + tokens_requested <= limit
+			if allowed then
+				remaining = limit - count - tokens_requested
+				reset_after = window
+			else
+				remaining = math.max(0, limit - count)
+				local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+				if newest[2] then
+					reset_after = tonumber(newest[2]) + window - now
+				end
+				retry_after = reset_after
+				local expire = count + tokens_requested - limit
+				if tokens_requested <= limit and expire > 0 then
+					local entry = redis.call('ZRANGE', key, expire - 1, expire - 1, 'WITHSCORES')
+					if entry[2] then
+						retry_after = tonumber(entry[2]) + window - now
+					end
+				end
+			end
+
+		elseif algorithm == 'sliding-window-counter' then
+			local window_start = now - (now % window)
+			local hash = redis.call('HMGET', key, 'start', 'current', 'previous')
+			local start = tonumber(hash[1]) or window_start
+			local current = tonumber(hash[2]) or 0
+			local previous = tonumber(hash[3]) or 0
+			if start ~= window_start then
+				if window_start - start == window then
+					previous = current
+				else
+					previous = 0
+				end
+				current = 0
+			end
+			local weight = 1 - ((now - window_start) / window)
+			local estimated = previous * weight + current
+			allowed = estimated + tokens_requested <= limit
+			if allowed then
+				current = current + tokens_requested
+				estimated = estimated + tokens_requested
+			end
+			remaining = math.max(0, math.floor(limit - estimated))
+			if current > 0 then
+				reset_after = window_start + 2 * window - now
+			elseif previous > 0 then
+				reset_after = window_start + window - now
+			end
+			if not allowed then
+				local room = limit - tokens_requested
+				if room < 0 then
+					retry_after = reset_after
+				elseif current <= room then
+					retry_after = window_start + (1 - (room - current) / previous) * window - now
+				else
+					retry_after = window_start + window + (1 - room / current) * window - now
+				end
+			end
+			state.start = window_start
+			state.current = current
+			state.previous = previous
+
+		elseif algorithm == 'fixed-window' then
+			if now < extra * 1000000 - window or now >= extra * 1000000 then
+				return {-1, now, 0, 0, i}
+			end
+			local count = tonumber(redis.call('GET', key)) or 0
+			allowed = count + tokens_requested <= limit
+			reset_after = math.max(0, extra * 1000000 - now)
+			if allowed then
+				remaining = limit - count - tokens_requested
+			else
+				remaining = math.max(0, limit - count)
+				retry_after = reset_after
+			end
+
+		elseif algorithm == 'gcra' then
+			local emission_interval = 1000000 / refill_rate
+			local tolerance = emission_interval * limit
+			local tat = tonumber(redis.call('GET', key))
+			if not tat or tat < now then
+				tat = now
+			end
+			local new_tat = tat + emission_interval * tokens_requested
+			local allow_at = new_tat - tolerance
+			allowed = allow_at <= now
+			if allowed then
+				remaining = math.floor((now - allow_at) / emission_interval)
+				reset_after = new_tat - now
+			else
+				remaining = math.max(0, math.floor((now - (tat - tolerance)) / emission_interval))
+				retry_after = allow_at - now
+				reset_after = tat - now
+			end
+			state.tat = new_tat
+
+		else
+			-- Token bucket with the same layout as the single rule script, times in seconds
+			local seconds = now / 1000000
+			local current = tonumber(redis.call('GET', key .. ':tokens')) or limit
+			local last_refill = tonumber(redis.call('GET', key .. ':last_refill')) or seconds
+			current = math.min(limit, current + (seconds - last_refill) * refill_rate)
+			allowed = current >= tokens_requested
+			if allowed then
+				current = current - tokens_requested
+			elseif refill_rate > 0 then
+				retry_after = (tokens_requested - current) / refill_rate * 1000000
+			end
+			remaining = math.floor(current)
+			if refill_rate > 0 then
+				reset_after = (limit - current) / refill_rate * 1000000
+			end
+			state.tokens = current
+			state.now = seconds
+		end
+
+		if not allowed then
+			return {i, remaining, math.ceil(retry_after), math.ceil(reset_after), i}
+		end
+		if i == 1 or remaining < tightest[2] then
+			tightest = {0, remaining, 0, math.ceil(reset_after), i}
+		end
+		states[i] = state
+	end
+
+	-- Second pass: every rule has room, take the tokens from all of them
+	for i, state in ipairs(states) do
+		local key = state.key
+		if state.algorithm == 'sliding-window-log' then
+			for j = 1, tokens_requested do
+				redis.call('ZADD', key, now, member .. ':' .. i .. ':' .. j)
+			end
+			redis.call('PEXPIRE', key, math.ceil(state.window / 1000))
+
+		elseif state.algorithm == 'sliding-window-counter' then
+			redis.call('HSET', key, 'start', state.start, 'current', state.current, 'previous', state.previous)
+			redis.call('PEXPIRE', key, math.ceil(state.window * 2 / 1000))
+
+		elseif state.algorithm == 'fixed-window' then
+			local count = redis.call('INCRBY', key, tokens_requested)
+			if count == tokens_requested then
+				redis.call('EXPIREAT', key, state.extra)
+			end
+
+		elseif state.algorithm == 'gcra' then
+			redis.call('SET', key, state.tat, 'PX', math.max(1, math.ceil((state.tat - now) / 1000)))
+
+		else
+			redis.call('SET', key .. ':tokens', state.tokens, 'EX', state.extra)
+			redis.call('SET', key .. ':last_refill', state.now, 'EX', state.extra)
+		end
+	end
+
+	return tightest
+	`
+	return script
+}
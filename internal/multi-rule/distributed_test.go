@@ -0,0 +1,149 @@
+package multi_rule
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMultiRuleLuaScript(t *testing.T) {
+	// The windows start on a minute, so the sliding window counter starts a new window
+	start := time.Unix(1699999980, 0)
+	windowEnd := start.Add(time.Minute)
+
+	type rule struct {
+		algorithm  string
+		key        string
+		capacity   int
+		refillRate string
+	}
+	tokenBucket := func(capacity int) rule { return rule{"token-bucket", "bucket", capacity, "1"} }
+	slidingLog := func(capacity int) rule { return rule{"sliding-window-log", "log", capacity, "0"} }
+	slidingCounter := func(capacity int) rule { return rule{"sliding-window-counter", "counter", capacity, "0"} }
+	fixedWindow := func(capacity int) rule { return rule{"fixed-window", "window", capacity, "0"} }
+	gcra := func(capacity int) rule { return rule{"gcra", "tat", capacity, "1"} }
+
+	tests := []struct {
+		name   string
+		rules  []rule
+		before int // Requests of one token allowed before
+		tokens int
+		want   []int64 // {rejected, remaining, retry_after, reset_after, rule} in microseconds
+	}{
+		{
+			name:   "every rule has room",
+			rules:  []rule{tokenBucket(5), slidingLog(3), slidingCounter(3), fixedWindow(3), gcra(5)},
+			tokens: 1,
+			want:   []int64{0, 2, 0, time.Minute.Microseconds(), 2},
+		},
+		{
+			name:   "first rule rejects",
+			rules:  []rule{tokenBucket(1), slidingLog(5), slidingCounter(5), fixedWindow(5), gcra(5)},
+			before: 1,
+			tokens: 1,
+			want:   []int64{1, 0, time.Second.Microseconds(), time.Second.Microseconds(), 1},
+		},
+		{
+			name:   "middle rule rejects",
+			rules:  []rule{tokenBucket(5), slidingLog(5), slidingCounter(2), fixedWindow(5), gcra(5)},
+			before: 2,
+			tokens: 1,
+			want:   []int64{3, 0, (90 * time.Second).Microseconds(), (2 * time.Minute).Microseconds(), 3},
+		},
+		{
+			name:   "last rule rejects",
+			rules:  []rule{tokenBucket(5), slidingLog(5), slidingCounter(5), gcra(5), fixedWindow(2)},
+			before: 2,
+			tokens: 1,
+			want:   []int64{5, 0, time.Minute.Microseconds(), time.Minute.Microseconds(), 5},
+		},
+		{
+			name:   "costly request rejected by the last rule",
+			rules:  []rule{tokenBucket(5), slidingLog(5), slidingCounter(5), fixedWindow(5), gcra(3)},
+			before: 1,
+			tokens: 3,
+			want:   []int64{5, 2, time.Second.Microseconds(), time.Second.Microseconds(), 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+			server.SetTime(start)
+
+			keys := make([]string, len(tt.rules))
+			for i, rule := range tt.rules {
+				keys[i] = rule.key
+			}
+			run := func(tokens int, member string) []int64 {
+				args := []interface{}{tokens, member}
+				for _, rule := range tt.rules {
+					var extra int64 = 60
+					if rule.algorithm == "fixed-window" {
+						extra = windowEnd.Unix()
+					}
+					args = append(args, rule.algorithm, rule.capacity, rule.refillRate, time.Minute.Microseconds(), extra)
+				}
+				values, err := client.Eval(context.Background(), MultiRuleLuaScript(), keys, args...).Int64Slice()
+				if err != nil {
+					t.Fatalf("Eval: %v", err)
+				}
+				return values
+			}
+
+			for i := 0; i < tt.before; i++ {
+				if values := run(1, fmt.Sprintf("before-%d", i)); values[0] != 0 {
+					t.Fatalf("request %d was rejected: %v", i, values)
+				}
+			}
+			before := server.Dump()
+
+			got := run(tt.tokens, "request")
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			// A rejected request is written to none of the rules
+			if got[0] != 0 {
+				if after := server.Dump(); after != before {
+					t.Errorf("state changed by a rejected request\nbefore:\n%s\nafter:\n%s", before, after)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiRuleLuaScriptOtherWindow(t *testing.T) {
+	windowEnd := time.Unix(1700000040, 0)
+
+	// The fixed window of the caller does not hold the time of Redis, so no rule is written
+	for _, now := range []time.Time{windowEnd.Add(-time.Minute - time.Millisecond), windowEnd} {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		server.SetTime(now)
+
+		args := []interface{}{1, "request",
+			"token-bucket", 5, "1", 0, 60,
+			"fixed-window", 3, "0", time.Minute.Microseconds(), windowEnd.Unix(),
+		}
+		got, err := client.Eval(context.Background(), MultiRuleLuaScript(), []string{"bucket", "window"}, args...).Int64Slice()
+		client.Close()
+		if err != nil {
+			t.Fatalf("Eval: %v", err)
+		}
+		if want := []int64{-1, now.UnixMicro(), 0, 0, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("at %v: got %v, want %v", now, got, want)
+		}
+		if keys := server.Keys(); len(keys) != 0 {
+			t.Errorf("at %v: keys = %v, want none", now, keys)
+		}
+	}
+}
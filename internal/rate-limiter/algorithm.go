@@ -0,0 +1,166 @@
+package rate_limiter
+
+import (
+	"fmt"
+	"time"
+
+	fixed_window "github.com/krishpatel023/ratelimiter/internal/fixed-window"
+	sliding_window_counter "github.com/krishpatel023/ratelimiter/internal/sliding-window-counter"
+	sliding_window_log "github.com/krishpatel023/ratelimiter/internal/sliding-window-log"
+	token_bucket "github.com/krishpatel023/ratelimiter/internal/token-bucket"
+)
+
+// Algorithm selects how a rate limiter decides if a request is allowed
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts up to the capacity and refills the bucket at the refill rate
+	TokenBucket Algorithm = "token-bucket"
+	// SlidingWindowLog allows at most capacity requests in any rolling window
+	SlidingWindowLog Algorithm = "sliding-window-log"
+	// SlidingWindowCounter approximates a rolling window of capacity requests by blending
+	// the counts of the current and previous windows - only two counters per key
+	SlidingWindowCounter Algorithm = "sliding-window-counter"
+	// FixedWindow allows capacity requests per window and resets on the window boundaries,
+	// windows can be aligned to the calendar with a WindowUnit
+	FixedWindow Algorithm = "fixed-window"
+	// GCRA gives the same burst and rate as TokenBucket while storing a single value per key,
+	// it is only available with the distributed rate limiter
+	GCRA Algorithm = "gcra"
+)
+
+// WindowUnit is a calendar unit the FixedWindow windows can be aligned to
+type WindowUnit = fixed_window.Unit
+
+const (
+	WindowMinute = fixed_window.Minute
+	WindowHour   = fixed_window.Hour
+	WindowDay    = fixed_window.Day
+	WindowMonth  = fixed_window.Month
+)
+
+// AlgorithmConfig holds the algorithm used by a rate limiter along with its algorithm specific settings
+type AlgorithmConfig struct {
+	Algorithm  Algorithm      // Algorithm used for every bucket - defaults to TokenBucket
+	Window     time.Duration  // Length of the window - used by the window based algorithms
+	WindowUnit WindowUnit     // Calendar unit the FixedWindow windows align to - takes precedence over Window
+	Location   *time.Location // Time zone of the calendar windows - defaults to UTC
+}
+
+// Limits holds the limit Allow checks every key against
+type Limits struct {
+	Capacity   int     // Tokens in the bucket, or requests per window for the window based algorithms
+	RefillRate float64 // Tokens added per second - used by TokenBucket and GCRA
+}
+
+// Bucket is implemented by every in-memory algorithm the local rate limiter can run
+// AllowRequest returns the decision along with the state of the bucket after it.
+// Check returns the same decision without taking any tokens, used to check every rule before taking from any.
+// SetLimits changes the limits of an existing bucket while keeping its state, e.g. after a reload
+type Bucket interface {
+	AllowRequest(tokens int) Result
+	Check(tokens int) Result
+	SetLimits(capacity int, refillRate float64)
+}
+
+// withDefaults fills in the algorithm when it is left empty
+func (c AlgorithmConfig) withDefaults() AlgorithmConfig {
+	if c.Algorithm == "" {
+		c.Algorithm = TokenBucket
+	}
+	if c.Location == nil {
+		c.Location = time.UTC
+	}
+	return c
+}
+
+// validate checks that the algorithm is known and has the settings it needs
+func (c AlgorithmConfig) validate() error {
+	switch c.Algorithm {
+	case TokenBucket, GCRA:
+		return nil
+	case SlidingWindowLog, SlidingWindowCounter:
+		if c.Window <= 0 {
+			return fmt.Errorf("algorithm %q requires a window greater than zero", c.Algorithm)
+		}
+		return nil
+	case FixedWindow:
+		switch c.WindowUnit {
+		case WindowMinute, WindowHour, WindowDay, WindowMonth:
+			return nil
+		case "":
+			if c.Window <= 0 {
+				return fmt.Errorf("algorithm %q requires a window unit or a window greater than zero", c.Algorithm)
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown window unit %q", c.WindowUnit)
+		}
+	default:
+		return fmt.Errorf("unknown rate limiting algorithm %q", c.Algorithm)
+	}
+}
+
+// sameBucket reports if a bucket created for the config can keep serving the other config
+// Only the settings the algorithm uses count - the limits are updated in place with SetLimits
+func (c AlgorithmConfig) sameBucket(other AlgorithmConfig) bool {
+	if c.Algorithm != other.Algorithm {
+		return false
+	}
+	switch c.Algorithm {
+	case SlidingWindowLog, SlidingWindowCounter:
+		return c.Window == other.Window
+	case FixedWindow:
+		if c.WindowUnit != other.WindowUnit {
+			return false
+		}
+		if c.WindowUnit == "" {
+			return c.Window == other.Window
+		}
+		// Every reload loads the time zone again, so they are compared by name
+		return c.Location.String() == other.Location.String()
+	default:
+		return true
+	}
+}
+
+// retention returns how long an idle bucket still holds state that matters
+// A bucket dropped earlier would forget the requests of a window that is still running
+func (c AlgorithmConfig) retention() time.Duration {
+	switch c.Algorithm {
+	case SlidingWindowLog:
+		return c.Window
+	case SlidingWindowCounter:
+		return 2 * c.Window
+	case FixedWindow:
+		switch c.WindowUnit {
+		case WindowMinute:
+			return time.Minute
+		case WindowHour:
+			return time.Hour
+		case WindowDay:
+			return 24 * time.Hour
+		case WindowMonth:
+			return 31 * 24 * time.Hour
+		}
+		return c.Window
+	default:
+		return 0
+	}
+}
+
+// newBucket creates an in-memory bucket for the configured algorithm
+// For the window based algorithms the capacity is the number of requests allowed per window
+// and the refill rate is not used
+func (c AlgorithmConfig) newBucket(capacity int, refillRate float64) Bucket {
+	switch c.Algorithm {
+	case SlidingWindowLog:
+		return sliding_window_log.NewSlidingWindowLog(capacity, c.Window)
+	case SlidingWindowCounter:
+		return sliding_window_counter.NewSlidingWindowCounter(capacity, c.Window)
+	case FixedWindow:
+		return fixed_window.NewFixedWindow(capacity, c.WindowUnit, c.Window, c.Location)
+	default:
+		return token_bucket.NewTokenBucket(capacity, refillRate)
+	}
+}
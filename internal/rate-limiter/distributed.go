@@ -2,22 +2,51 @@ package rate_limiter
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
+	"github.com/krishpatel023/ratelimiter/internal/concurrency"
+	fixed_window "github.com/krishpatel023/ratelimiter/internal/fixed-window"
+	"github.com/krishpatel023/ratelimiter/internal/gcra"
+	multi_rule "github.com/krishpatel023/ratelimiter/internal/multi-rule"
+	sliding_window_counter "github.com/krishpatel023/ratelimiter/internal/sliding-window-counter"
+	sliding_window_log "github.com/krishpatel023/ratelimiter/internal/sliding-window-log"
 	token_bucket "github.com/krishpatel023/ratelimiter/internal/token-bucket"
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrBackendUnavailable is returned when Redis cannot be reached
+var ErrBackendUnavailable = errors.New("rate limiter backend unavailable")
+
 type DistributedRateLimiter struct {
 	client          *redis.Client
 	keyPrefix       string
 	expirationTime  time.Duration
 	cleanupInterval time.Duration
+	algorithm       AlgorithmConfig
+	limits          Limits        // Limit of the keys checked by Allow
+	instanceID      string        // Random id of this instance - keeps sorted set members unique across instances
+	sequence        atomic.Uint64 // Per instance counter - keeps sorted set members unique within the instance
+	clockOffset     atomic.Int64  // Nanoseconds the Redis clock is ahead of this instance - learned from the fixed window
 }
 
-func NewDistributedRateLimiter(redisAddr, password string, db int, keyPrefix string, cleanupInterval, expirationTime time.Duration) (*DistributedRateLimiter, error) {
+// fixedWindowAttempts is how many times a fixed window request is sent when its window does not hold the
+// time of Redis - the first retry uses the time Redis returned, a second one covers a window ending in between
+const fixedWindowAttempts = 3
+
+func NewDistributedRateLimiter(redisAddr, password string, db int, keyPrefix string, cleanupInterval, expirationTime time.Duration, algorithm AlgorithmConfig, limits Limits) (*DistributedRateLimiter, error) {
+	algorithm = algorithm.withDefaults()
+	if err := algorithm.validate(); err != nil {
+		return nil, err
+	}
 
 	// Create Redis client
 	client := redis.NewClient(&redis.Options{
@@ -33,52 +62,365 @@ func NewDistributedRateLimiter(redisAddr, password string, db int, keyPrefix str
 	// Wait for Redis to be ready
 	// Requesting the ping command for at least 3 times
 	// with a 2 second interval
+	var err error
 	for i := 0; i < 3; i++ {
-		if err := client.Ping(ctx).Err(); err == nil {
+		if err = client.Ping(ctx).Err(); err == nil {
 			break
 		}
 		time.Sleep(2 * time.Second)
 	}
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+
+	instanceID := make([]byte, 8)
+	_, _ = rand.Read(instanceID)
 
 	return &DistributedRateLimiter{
 		client:          client,
 		keyPrefix:       keyPrefix,
 		expirationTime:  expirationTime,
 		cleanupInterval: cleanupInterval,
+		algorithm:       algorithm,
+		limits:          limits,
+		instanceID:      hex.EncodeToString(instanceID),
 	}, nil
 }
 
+// Ping checks that Redis can be reached
+func (rl *DistributedRateLimiter) Ping(ctx context.Context) error {
+	if err := rl.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	return nil
+}
+
 // Stop the rate limiter
 // It closes the Redis client internally
 func (rl *DistributedRateLimiter) Stop() {
 	_ = rl.client.Close()
 }
 
-// AllowRequest checks if the request is allowed
-func (rl *DistributedRateLimiter) AllowRequest(id string, tokens int, totalTokens int, refillRate int) bool {
-
+// AllowRequest checks if the request is allowed and returns the decision with the state of the bucket
+// Errors are logged and reject the request - use Allow to get them along with the context of the request
+func (rl *DistributedRateLimiter) AllowRequest(id string, tokens int, totalTokens int, refillRate float64) Result {
 	// Create a context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
+
+	result, err := rl.check(ctx, id, tokens, totalTokens, refillRate, rl.algorithm)
+	if err != nil {
+		log.Printf("Request rejected: %v", err)
+	}
+	return result
+}
+
+// Allow checks the request against the limits the rate limiter was created with
+// Redis is called with the context, so the check ends with the request or at its deadline
+func (rl *DistributedRateLimiter) Allow(ctx context.Context, key string, cost int) (Result, error) {
+	return rl.check(ctx, key, cost, rl.limits.Capacity, rl.limits.RefillRate, rl.algorithm)
+}
+
+// AllowRequestWithAlgorithm checks the request against a bucket running the given algorithm
+// instead of the one of the limiter, e.g. for a daily quota next to a token bucket
+func (rl *DistributedRateLimiter) AllowRequestWithAlgorithm(ctx context.Context, id string, tokens int, totalTokens int, refillRate float64, algorithm AlgorithmConfig) (Result, error) {
+	return rl.check(ctx, id, tokens, totalTokens, refillRate, algorithm.withDefaults())
+}
+
+// check runs the Lua script of the algorithm for the request
+// The request is rejected along with the error when the script cannot be run
+func (rl *DistributedRateLimiter) check(ctx context.Context, id string, tokens int, totalTokens int, refillRate float64, algorithm AlgorithmConfig) (Result, error) {
+	for attempt := 1; ; attempt++ {
+		values, err := rl.checkOnce(ctx, id, tokens, totalTokens, refillRate, algorithm)
+		if err != nil {
+			return Result{Limit: totalTokens}, err
+		}
+
+		// The fixed window was not the one of the Redis clock
+		if values[0] == -1 {
+			if attempt == fixedWindowAttempts {
+				return Result{Limit: totalTokens}, fmt.Errorf("fixed window does not match the Redis clock")
+			}
+			rl.syncClock(values[1])
+			continue
+		}
+
+		return Result{
+			Allowed:    values[0] == 1,
+			Limit:      totalTokens,
+			Remaining:  int(values[1]),
+			RetryAfter: time.Duration(values[2]) * time.Microsecond,
+			ResetAfter: time.Duration(values[3]) * time.Microsecond,
+		}, nil
+	}
+}
+
+// checkOnce runs the Lua script of the algorithm for the request and returns its reply
+func (rl *DistributedRateLimiter) checkOnce(ctx context.Context, id string, tokens int, totalTokens int, refillRate float64, algorithm AlgorithmConfig) ([]int64, error) {
 	bucketKey := rl.keyPrefix + ":" + id
 
-	// Use Lua script for atomic operations
-	script := token_bucket.TokenBucketLuaScript()
+	// Every script returns the decision along with the state of the bucket
+	var script string
+	var keys []string
+	var args []interface{}
+
+	switch algorithm.Algorithm {
+	case GCRA:
+		if refillRate <= 0 {
+			return nil, fmt.Errorf("algorithm %q requires a refill rate greater than zero", GCRA)
+		}
+		script = gcra.GCRALuaScript()
+		keys = []string{bucketKey + ":tat"}
+		args = []interface{}{
+			tokens,
+			totalTokens,
+			strconv.FormatFloat(refillRate, 'f', -1, 64),
+		}
+	case SlidingWindowLog:
+		script = sliding_window_log.SlidingWindowLogLuaScript()
+		keys = []string{bucketKey + ":log"}
+		args = []interface{}{
+			tokens,
+			totalTokens,
+			algorithm.Window.Microseconds(),
+			rl.nextMember(),
+		}
+	case SlidingWindowCounter:
+		script = sliding_window_counter.SlidingWindowCounterLuaScript()
+		keys = []string{bucketKey + ":counter"}
+		args = []interface{}{
+			tokens,
+			totalTokens,
+			algorithm.Window.Microseconds(),
+		}
+	case FixedWindow:
+		// The window is worked out here since Lua has no time zone data, each window gets its own
+		// counter named after its start. The script checks it against the time of Redis
+		start, end := fixed_window.Bounds(rl.redisNow(), algorithm.WindowUnit, algorithm.Window, algorithm.Location)
+		script = fixed_window.FixedWindowLuaScript()
+		keys = []string{bucketKey + ":window:" + strconv.FormatInt(start.Unix(), 10)}
+		args = []interface{}{
+			tokens,
+			totalTokens,
+			end.Unix(),
+			start.Unix(),
+		}
+	default:
+		script = token_bucket.TokenBucketLuaScript()
+		keys = []string{bucketKey}
+		args = []interface{}{
+			strconv.FormatFloat(float64(tokens), 'f', -1, 64),
+			strconv.FormatFloat(float64(totalTokens), 'f', -1, 64),
+			strconv.FormatFloat(refillRate, 'f', -1, 64),
+			int(rl.expirationTime.Seconds()),
+		}
+	}
 
 	// Execute the Lua script
-	keys := []string{bucketKey}
-	args := []interface{}{
-		strconv.FormatFloat(float64(tokens), 'f', -1, 64),
-		strconv.FormatFloat(float64(totalTokens), 'f', -1, 64),
-		strconv.FormatFloat(float64(refillRate), 'f', -1, 64),
-		int(rl.expirationTime.Seconds()),
+	values, err := rl.client.Eval(ctx, script, keys, args...).Int64Slice()
+	if err == nil && len(values) != 4 {
+		err = fmt.Errorf("unexpected reply of %d values", len(values))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error executing Redis Lua script: %w", err)
 	}
+	return values, nil
+}
 
-	result, err := rl.client.Eval(ctx, script, keys, args...).Int()
+// redisNow returns the time of the Redis clock as last seen by this instance
+// The fixed windows are worked out from it, so instances with skewed clocks share the same windows
+func (rl *DistributedRateLimiter) redisNow() time.Time {
+	return time.Now().Add(time.Duration(rl.clockOffset.Load()))
+}
+
+// syncClock learns the offset of the Redis clock from the time in microseconds a script returned
+func (rl *DistributedRateLimiter) syncClock(redisMicros int64) {
+	rl.clockOffset.Store(int64(time.UnixMicro(redisMicros).Sub(time.Now())))
+}
+
+// AllowRequestRules checks the request against every rule of the request group at once
+// All the rules are checked and updated by a single Lua script, so the request is allowed only if
+// every rule has room for it and nothing is deducted from any rule when one rejects it.
+// It returns the decision of the rule that rejected the request along with its index, or the decision
+// of the rule with the fewest tokens left and -1 when the request is allowed. Errors reject with -1 and are returned
+func (rl *DistributedRateLimiter) AllowRequestRules(ctx context.Context, id string, tokens int, rules []Rule) (Result, int, error) {
+	return rl.AllowRequestLevels(ctx, ruleLevels(id, rules), tokens)
+}
+
+// AllowRequestLevels checks the request against the rules of all its levels at once, e.g. the limit of
+// the user and the one of its organisation. Like AllowRequestRules all the levels are checked by one
+// Lua script, and it returns the decision of the level that rejected the request with its index
+// or the decision of the level closest to its limit with -1
+func (rl *DistributedRateLimiter) AllowRequestLevels(ctx context.Context, levels []Level, tokens int) (Result, int, error) {
+	for attempt := 1; ; attempt++ {
+		values, err := rl.checkLevels(ctx, levels, tokens)
+		if err != nil {
+			return Result{}, -1, err
+		}
+
+		// A fixed window was not the one of the Redis clock
+		if values[0] == -1 {
+			if attempt == fixedWindowAttempts {
+				return Result{}, -1, fmt.Errorf("fixed window does not match the Redis clock")
+			}
+			rl.syncClock(values[1])
+			continue
+		}
+
+		result := Result{
+			Allowed:    values[0] == 0,
+			Remaining:  int(values[1]),
+			RetryAfter: time.Duration(values[2]) * time.Microsecond,
+			ResetAfter: time.Duration(values[3]) * time.Microsecond,
+		}
+		if rule := int(values[4]) - 1; rule >= 0 && rule < len(levels) {
+			result.Limit = levels[rule].Rule.Capacity
+		}
+		return result, int(values[0]) - 1, nil
+	}
+}
+
+// checkLevels runs the Lua script of the levels for the request and returns its reply
+func (rl *DistributedRateLimiter) checkLevels(ctx context.Context, levels []Level, tokens int) ([]int64, error) {
+	now := rl.redisNow()
+	keys := make([]string, 0, len(levels))
+	args := make([]interface{}, 0, 2+5*len(levels))
+	args = append(args, tokens, rl.nextMember())
+
+	for _, level := range levels {
+		rule := level.Rule
+		algorithm := rule.algorithmConfig()
+		key := rl.keyPrefix + ":" + ruleID(level.ID, rule)
+
+		// The last value is the end of the window for the fixed window and the expiration in seconds
+		// for the token bucket - long enough for an idle bucket to refill completely
+		window := algorithm.Window.Microseconds()
+		var extra int64
+		switch algorithm.Algorithm {
+		case SlidingWindowLog:
+			key += ":log"
+		case SlidingWindowCounter:
+			key += ":counter"
+		case FixedWindow:
+			start, end := fixed_window.Bounds(now, algorithm.WindowUnit, algorithm.Window, algorithm.Location)
+			key += ":window:" + strconv.FormatInt(start.Unix(), 10)
+			window = end.Sub(start).Microseconds()
+			extra = end.Unix()
+		case GCRA:
+			key += ":tat"
+		default:
+			extra = rl.levelExpiration(rule)
+		}
+
+		keys = append(keys, key)
+		args = append(args,
+			string(algorithm.Algorithm),
+			rule.Capacity,
+			strconv.FormatFloat(rule.RefillRate, 'f', -1, 64),
+			window,
+			extra,
+		)
+	}
+
+	// Execute the Lua script
+	values, err := rl.client.Eval(ctx, multi_rule.MultiRuleLuaScript(), keys, args...).Int64Slice()
+	if err == nil && len(values) != 5 {
+		err = fmt.Errorf("unexpected reply of %d values", len(values))
+	}
 	if err != nil {
-		log.Printf("Error executing Redis Lua script: %v", err)
-		return false
+		return nil, fmt.Errorf("error executing Redis Lua script: %w", err)
+	}
+	return values, nil
+}
+
+// levelExpiration returns the expiration in seconds of the token bucket of a level
+// A bucket without a refill rate never refills, so it only gets the expiration of the limiter
+func (rl *DistributedRateLimiter) levelExpiration(rule Rule) int64 {
+	expiration := max(rl.expirationTime.Seconds(), 1)
+	if rule.RefillRate > 0 {
+		expiration = max(expiration, float64(rule.Capacity)/rule.RefillRate)
+	}
+	return int64(expiration)
+}
+
+// nextMember returns a sorted set member that is unique across all the instances
+func (rl *DistributedRateLimiter) nextMember() string {
+	return rl.instanceID + ":" + strconv.FormatUint(rl.sequence.Add(1), 36)
+}
+
+// AcquireSlot takes an in-flight slot for the request group
+// It fails if the group already has perKey requests in flight or all the groups together have
+// global requests in flight - a limit of zero means no limit.
+// Slots are leases that expire after leaseTime, so the slots of a crashed instance are freed.
+// The lease is renewed while the slot is held and the returned function gives the slot back.
+// The renewals and the release outlive the context - they only keep its values
+func (rl *DistributedRateLimiter) AcquireSlot(ctx context.Context, id string, perKey, global int, leaseTime time.Duration) (func(), bool, error) {
+	// The lease is kept in milliseconds in Redis
+	if leaseTime < time.Millisecond {
+		return nil, false, fmt.Errorf("lease time must be at least 1ms, got %v", leaseTime)
+	}
+	keys := []string{rl.keyPrefix + ":" + id + ":concurrency", rl.keyPrefix + ":concurrency"}
+	leaseID := rl.nextMember()
+
+	result, err := rl.client.Eval(ctx, concurrency.AcquireLuaScript(), keys, leaseID, perKey, global, leaseTime.Milliseconds()).Int()
+	if err != nil {
+		return nil, false, fmt.Errorf("error executing Redis Lua script: %w", err)
+	}
+	if result != 1 {
+		return nil, false, nil
+	}
+
+	// Keep the lease alive while the request is in flight
+	background := context.WithoutCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(leaseTime / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(background, 500*time.Millisecond)
+				if err := rl.client.Eval(ctx, concurrency.RenewLuaScript(), keys, leaseID, leaseTime.Milliseconds()).Err(); err != nil {
+					log.Printf("Error executing Redis Lua script: %v", err)
+				}
+				cancel()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+
+			ctx, cancel := context.WithTimeout(background, 500*time.Millisecond)
+			defer cancel()
+			pipe := rl.client.Pipeline()
+			pipe.ZRem(ctx, keys[0], leaseID)
+			pipe.ZRem(ctx, keys[1], leaseID)
+			if _, err := pipe.Exec(ctx); err != nil {
+				log.Printf("Error releasing concurrency slot: %v", err)
+			}
+		})
+	}, true, nil
+}
+
+// AdjustRefillRate moves the adaptive refill rate shared by all the instances after the responses
+// of the tally and returns the new rate
+func (rl *DistributedRateLimiter) AdjustRefillRate(ctx context.Context, tally adaptive.Tally, settings adaptive.Settings) (float64, error) {
+	keys := []string{rl.keyPrefix + ":adaptive:rate"}
+	args := []interface{}{
+		tally.Healthy,
+		tally.Unhealthy,
+		strconv.FormatFloat(settings.MaxRate, 'f', -1, 64),
+		strconv.FormatFloat(settings.MinRate, 'f', -1, 64),
+		strconv.FormatFloat(settings.DecreaseFactor, 'f', -1, 64),
+		strconv.FormatFloat(settings.IncreaseStep, 'f', -1, 64),
+		max(rl.expirationTime, time.Second).Milliseconds(),
 	}
 
-	return result == 1
+	return rl.client.Eval(ctx, adaptive.AdjustLuaScript(), keys, args...).Float64()
 }
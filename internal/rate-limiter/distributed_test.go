@@ -0,0 +1,149 @@
+package rate_limiter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestDistributedRateLimiter returns a distributed rate limiter backed by miniredis
+func newTestDistributedRateLimiter(t *testing.T) (*DistributedRateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	rl, err := NewDistributedRateLimiter(server.Addr(), "", 0, "test", time.Minute, 30*time.Minute, AlgorithmConfig{}, Limits{})
+	if err != nil {
+		t.Fatalf("NewDistributedRateLimiter: %v", err)
+	}
+	t.Cleanup(rl.Stop)
+	return rl, server
+}
+
+func TestDistributedAllowRequestLevelsExpiration(t *testing.T) {
+	tests := []struct {
+		name       string
+		capacity   int
+		refillRate float64
+		wantTTL    time.Duration
+	}{
+		{name: "no refill rate keeps the expiration of the limiter", capacity: 2, refillRate: 0, wantTTL: 30 * time.Minute},
+		{name: "fast refill keeps the expiration of the limiter", capacity: 10, refillRate: 100, wantTTL: 30 * time.Minute},
+		{name: "slow refill lasts until the bucket is full", capacity: 100, refillRate: 0.01, wantTTL: 10000 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl, server := newTestDistributedRateLimiter(t)
+			levels := []Level{
+				{ID: "global", Rule: Rule{Name: "global", Capacity: 100, RefillRate: 10}},
+				{ID: "user", Rule: Rule{Name: "key", Capacity: tt.capacity, RefillRate: tt.refillRate}},
+			}
+
+			result, rejected, err := rl.AllowRequestLevels(context.Background(), levels, 1)
+			if err != nil {
+				t.Fatalf("AllowRequestLevels: %v", err)
+			}
+			if !result.Allowed || rejected != -1 {
+				t.Fatalf("allowed, rejected = %v, %d, want true, -1", result.Allowed, rejected)
+			}
+			if ttl := server.TTL("test:user:rule:key:tokens"); ttl != tt.wantTTL {
+				t.Errorf("TTL = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestDistributedFixedWindowClockSkew(t *testing.T) {
+	algorithm := AlgorithmConfig{Algorithm: FixedWindow, Window: time.Minute}
+	rule := Rule{Name: "key", Capacity: 2, Algorithm: FixedWindow, Window: time.Minute}
+
+	tests := []struct {
+		name string
+		skew time.Duration // How far the Redis clock is ahead of this instance
+	}{
+		{name: "same clock"},
+		{name: "redis ahead", skew: 90 * time.Second},
+		{name: "redis behind", skew: -3 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The windows are counted by the Redis clock, whatever the clock of the instance says
+			redisTime := time.Now().Add(tt.skew).Truncate(time.Minute).Add(15 * time.Second)
+			windowStart := strconv.FormatInt(redisTime.Truncate(time.Minute).Unix(), 10)
+
+			t.Run("single rule", func(t *testing.T) {
+				rl, server := newTestDistributedRateLimiter(t)
+				server.SetTime(redisTime)
+
+				for i, wantAllowed := range []bool{true, true, false} {
+					result, err := rl.AllowRequestWithAlgorithm(context.Background(), "user", 1, 2, 0, algorithm)
+					if err != nil {
+						t.Fatalf("request %d: AllowRequestWithAlgorithm: %v", i, err)
+					}
+					if result.Allowed != wantAllowed || result.ResetAfter != 45*time.Second {
+						t.Fatalf("request %d: allowed, reset after = %v, %v, want %v, 45s", i, result.Allowed, result.ResetAfter, wantAllowed)
+					}
+				}
+				if keys := server.Keys(); len(keys) != 1 || keys[0] != "test:user:window:"+windowStart {
+					t.Errorf("keys = %v, want the window starting at %s", keys, windowStart)
+				}
+			})
+
+			t.Run("levels", func(t *testing.T) {
+				rl, server := newTestDistributedRateLimiter(t)
+				server.SetTime(redisTime)
+
+				levels := []Level{{ID: "user", Rule: rule}}
+				for i, wantAllowed := range []bool{true, true, false} {
+					result, _, err := rl.AllowRequestLevels(context.Background(), levels, 1)
+					if err != nil {
+						t.Fatalf("request %d: AllowRequestLevels: %v", i, err)
+					}
+					if result.Allowed != wantAllowed || result.ResetAfter != 45*time.Second {
+						t.Fatalf("request %d: allowed, reset after = %v, %v, want %v, 45s", i, result.Allowed, result.ResetAfter, wantAllowed)
+					}
+				}
+				if keys := server.Keys(); len(keys) != 1 || keys[0] != "test:user:rule:key:window:"+windowStart {
+					t.Errorf("keys = %v, want the window starting at %s", keys, windowStart)
+				}
+			})
+		})
+	}
+}
+
+func TestDistributedAcquireSlot(t *testing.T) {
+	rl, _ := newTestDistributedRateLimiter(t)
+	ctx := context.Background()
+
+	release, ok, err := rl.AcquireSlot(ctx, "user", 1, 0, 40*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("AcquireSlot = %v, %v, want a slot", ok, err)
+	}
+
+	// The lease is renewed while the slot is held, long after it would have expired
+	time.Sleep(100 * time.Millisecond)
+	if _, ok, err := rl.AcquireSlot(ctx, "user", 1, 0, 40*time.Millisecond); err != nil || ok {
+		t.Fatalf("AcquireSlot of a held slot = %v, %v, want no slot", ok, err)
+	}
+
+	release()
+	release() // Giving the slot back twice is fine
+	again, ok, err := rl.AcquireSlot(ctx, "user", 1, 0, 40*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("AcquireSlot of a released slot = %v, %v, want a slot", ok, err)
+	}
+	again()
+}
+
+func TestDistributedAcquireSlotLeaseTime(t *testing.T) {
+	rl, _ := newTestDistributedRateLimiter(t)
+
+	for _, leaseTime := range []time.Duration{0, time.Nanosecond, time.Millisecond - 1} {
+		if _, ok, err := rl.AcquireSlot(context.Background(), "user", 1, 0, leaseTime); err == nil || ok {
+			t.Errorf("AcquireSlot with a lease of %v = %v, %v, want an error", leaseTime, ok, err)
+		}
+	}
+}
@@ -1,27 +1,67 @@
 package rate_limiter
 
 import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lru "github.com/hashicorp/golang-lru"
-	token_bucket "github.com/krishpatel023/ratelimiter/internal/token-bucket"
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
+	"github.com/krishpatel023/ratelimiter/internal/concurrency"
 )
 
 type BucketWrapper struct {
-	Bucket   *token_bucket.TokenBucket
-	LastUsed time.Time
+	Bucket    Bucket
+	lastUsed  atomic.Int64    // Unix time of the last use in nanoseconds - updated under the read lock
+	Algorithm AlgorithmConfig // Algorithm the bucket runs along with its window
+	Retention time.Duration   // Idle time the bucket is kept for at least - the length of its window
 }
 
+// touch records that the bucket was just used
+func (wrapper *BucketWrapper) touch() {
+	wrapper.lastUsed.Store(time.Now().UnixNano())
+}
+
+// LastUsed returns the time the bucket was last used
+func (wrapper *BucketWrapper) LastUsed() time.Time {
+	return time.Unix(0, wrapper.lastUsed.Load())
+}
+
+// levelLockStripes is the number of locks the level buckets are spread over
+// Requests whose levels share no stripe are checked in parallel, while a level every request uses,
+// like the global bucket, still checks them one at a time
+const levelLockStripes = 256
+
 type LocalRateLimiter struct {
 	buckets       *lru.Cache
 	mu            sync.RWMutex
-	cleanupTicker *time.Ticker  // Ticker for cleanup routine - to remove expired buckets
-	stopCleanup   chan struct{} // Channel to stop the cleanup routine
-	expiration    time.Duration // Expiration time for buckets
+	cleanupTicker *time.Ticker                 // Ticker for cleanup routine - to remove expired buckets
+	stopCleanup   chan struct{}                // Channel to stop the cleanup routine
+	expiration    time.Duration                // Expiration time for buckets
+	algorithm     AlgorithmConfig              // Algorithm used for every bucket
+	limits        Limits                       // Limit of the keys checked by Allow
+	slots         *concurrency.Semaphore       // In-flight requests per key and in total
+	levelLocks    [levelLockStripes]sync.Mutex // Striped locks of the level buckets - a request takes from its levels only once all have room
+	adaptiveMu    sync.Mutex
+	adaptiveRate  float64 // Refill rate set by the adaptive mode - zero until the first adjustment
 }
 
-func NewLocalRateLimiter(totalEntries int, cleanupInterval, expiration time.Duration) (*LocalRateLimiter, error) {
+func NewLocalRateLimiter(totalEntries int, cleanupInterval, expiration time.Duration, algorithm AlgorithmConfig, limits Limits) (*LocalRateLimiter, error) {
+	algorithm = algorithm.withDefaults()
+	if err := algorithm.validate(); err != nil {
+		return nil, err
+	}
+	if algorithm.Algorithm == GCRA {
+		return nil, fmt.Errorf("algorithm %q is only supported by the distributed rate limiter", algorithm.Algorithm)
+	}
+	if cleanupInterval <= 0 {
+		return nil, fmt.Errorf("cleanup interval must be greater than zero, got %v", cleanupInterval)
+	}
+
 	cache, err := lru.New(totalEntries)
 	if err != nil {
 		return nil, err
@@ -32,6 +72,9 @@ func NewLocalRateLimiter(totalEntries int, cleanupInterval, expiration time.Dura
 		cleanupTicker: time.NewTicker(cleanupInterval),
 		stopCleanup:   make(chan struct{}),
 		expiration:    expiration,
+		algorithm:     algorithm,
+		limits:        limits,
+		slots:         concurrency.NewSemaphore(),
 	}
 
 	// Start the cleanup routine
@@ -62,7 +105,8 @@ func (rl *LocalRateLimiter) cleanupExpiredBuckets() {
 		keyStr := key.(string)
 		if val, ok := rl.buckets.Peek(keyStr); ok {
 			wrapper := val.(*BucketWrapper)
-			if now.Sub(wrapper.LastUsed) > rl.expiration {
+			// Window based buckets are kept for at least a window
+			if now.Sub(wrapper.LastUsed()) > max(rl.expiration, wrapper.Retention) {
 				expiredKeys = append(expiredKeys, keyStr)
 			}
 		}
@@ -83,12 +127,18 @@ func (rl *LocalRateLimiter) Stop() {
 	close(rl.stopCleanup)
 }
 
-func (rl *LocalRateLimiter) GetBucket(id string, capacity int, refillRate int) *token_bucket.TokenBucket {
+func (rl *LocalRateLimiter) GetBucket(id string, capacity int, refillRate float64) Bucket {
+	return rl.getBucket(id, capacity, refillRate, rl.algorithm)
+}
+
+// getBucket returns the bucket of the request group, creating one running the algorithm if needed
+// A bucket running another algorithm or window is replaced, e.g. after a reload changed the window
+func (rl *LocalRateLimiter) getBucket(id string, capacity int, refillRate float64, algorithm AlgorithmConfig) Bucket {
 	// First check with read lock
 	rl.mu.RLock()
-	if val, ok := rl.buckets.Get(id); ok {
+	if val, ok := rl.buckets.Get(id); ok && val.(*BucketWrapper).Algorithm.sameBucket(algorithm) {
 		wrapper := val.(*BucketWrapper)
-		wrapper.LastUsed = time.Now() // Update last used time
+		wrapper.touch() // Update last used time
 		rl.mu.RUnlock()
 		return wrapper.Bucket
 	}
@@ -99,32 +149,148 @@ func (rl *LocalRateLimiter) GetBucket(id string, capacity int, refillRate int) *
 	defer rl.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if val, ok := rl.buckets.Get(id); ok {
+	if val, ok := rl.buckets.Get(id); ok && val.(*BucketWrapper).Algorithm.sameBucket(algorithm) {
 		wrapper := val.(*BucketWrapper)
-		wrapper.LastUsed = time.Now() // Update last used time
+		wrapper.touch() // Update last used time
 		return wrapper.Bucket
 	}
 
 	// Create new bucket if still not found
-	tb := token_bucket.NewTokenBucket(capacity, refillRate)
+	bucket := algorithm.newBucket(capacity, refillRate)
 	wrapper := &BucketWrapper{
-		Bucket:   tb,
-		LastUsed: time.Now(),
+		Bucket:    bucket,
+		Algorithm: algorithm,
+		Retention: algorithm.retention(),
 	}
+	wrapper.touch()
 	rl.buckets.Add(id, wrapper)
-	return tb
+	return bucket
+}
+
+// AllowRequest checks if the request is allowed and returns the decision with the state of the bucket
+func (rl *LocalRateLimiter) AllowRequest(id string, tokens int, capacity int, refillRate float64) Result {
+	return rl.AllowRequestWithAlgorithm(id, tokens, capacity, refillRate, rl.algorithm)
+}
+
+// Allow checks the request against the limits the rate limiter was created with
+// The buckets are in memory, so the context only stops requests that are already cancelled
+func (rl *LocalRateLimiter) Allow(ctx context.Context, key string, cost int) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{Limit: rl.limits.Capacity}, err
+	}
+	return rl.AllowRequest(key, cost, rl.limits.Capacity, rl.limits.RefillRate), nil
 }
 
-func (rl *LocalRateLimiter) AllowRequest(id string, tokens int, capacity int, refillRate int) bool {
-	bucket := rl.GetBucket(id, capacity, refillRate)
+// AllowRequestWithAlgorithm checks the request against a bucket running the given algorithm
+// instead of the one of the limiter, e.g. for a daily quota next to a token bucket.
+// Use a distinct id for every algorithm - a bucket running another algorithm is replaced
+func (rl *LocalRateLimiter) AllowRequestWithAlgorithm(id string, tokens int, capacity int, refillRate float64, algorithm AlgorithmConfig) Result {
+	bucket := rl.getBucket(id, capacity, refillRate, algorithm.withDefaults())
 
 	// Update LastUsed time after the bucket is actually used
 	rl.mu.Lock()
 	if val, ok := rl.buckets.Get(id); ok {
 		wrapper := val.(*BucketWrapper)
-		wrapper.LastUsed = time.Now()
+		wrapper.touch()
 	}
 	rl.mu.Unlock()
 
+	// The limits can change over the life of a bucket, e.g. in adaptive mode or after a reload
+	bucket.SetLimits(capacity, refillRate)
+
 	return bucket.AllowRequest(tokens)
 }
+
+// AllowRequestRules checks the request against every rule of the request group at once
+// The request is allowed only if all the rules have room for it. When a rule rejects the request,
+// nothing is deducted from any of them.
+// It returns the decision of the rule that rejected the request along with its index, or the decision
+// of the rule with the fewest tokens left and -1 when the request is allowed
+func (rl *LocalRateLimiter) AllowRequestRules(id string, tokens int, rules []Rule) (Result, int) {
+	return rl.AllowRequestLevels(ruleLevels(id, rules), tokens)
+}
+
+// AllowRequestLevels checks the request against the rules of all its levels at once, e.g. the limit of
+// the user and the one of its organisation. Like AllowRequestRules nothing is deducted from any level
+// when one rejects the request, and it returns the decision of the level that rejected it with its index
+// or the decision of the level closest to its limit with -1
+func (rl *LocalRateLimiter) AllowRequestLevels(levels []Level, tokens int) (Result, int) {
+	ids := make([]string, len(levels))
+	buckets := make([]Bucket, len(levels))
+	for i, level := range levels {
+		rule := level.Rule
+		ids[i] = ruleID(level.ID, rule)
+		buckets[i] = rl.getBucket(ids[i], rule.Capacity, rule.RefillRate, rule.algorithmConfig())
+		buckets[i].SetLimits(rule.Capacity, rule.RefillRate)
+	}
+
+	// Same as the Lua script of the distributed rate limiter - every level is checked first and
+	// the tokens are only taken once all of them have room, so a rejected request leaves no trace
+	unlock := rl.lockLevels(ids)
+	defer unlock()
+
+	for i, bucket := range buckets {
+		if result := bucket.Check(tokens); !result.Allowed {
+			return result, i
+		}
+	}
+
+	var tightest Result
+	for i, bucket := range buckets {
+		result := bucket.AllowRequest(tokens)
+		if i == 0 || result.Remaining < tightest.Remaining {
+			tightest = result
+		}
+	}
+	tightest.Allowed = true
+	return tightest, -1
+}
+
+// lockLevels locks the stripes of the bucket ids and returns the function unlocking them
+// The stripes are locked in ascending order, so two requests sharing some of their levels cannot deadlock
+func (rl *LocalRateLimiter) lockLevels(ids []string) func() {
+	stripes := make([]int, len(ids))
+	for i, id := range ids {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(id))
+		stripes[i] = int(hash.Sum32() % levelLockStripes)
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, stripe := range stripes {
+		rl.levelLocks[stripe].Lock()
+	}
+	return func() {
+		for _, stripe := range stripes {
+			rl.levelLocks[stripe].Unlock()
+		}
+	}
+}
+
+// AcquireSlot takes an in-flight slot for the request group
+// It fails if the group already has perKey requests in flight or all the groups together have
+// global requests in flight - a limit of zero means no limit. The returned function gives the slot back
+func (rl *LocalRateLimiter) AcquireSlot(id string, perKey, global int) (func(), bool) {
+	if !rl.slots.Acquire(id, perKey, global) {
+		return nil, false
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { rl.slots.Release(id) })
+	}, true
+}
+
+// AdjustRefillRate moves the adaptive refill rate of the limiter after the responses of the tally
+// and returns the new rate
+func (rl *LocalRateLimiter) AdjustRefillRate(tally adaptive.Tally, settings adaptive.Settings) float64 {
+	rl.adaptiveMu.Lock()
+	defer rl.adaptiveMu.Unlock()
+
+	if rl.adaptiveRate == 0 {
+		rl.adaptiveRate = settings.MaxRate
+	}
+	rl.adaptiveRate = adaptive.Next(rl.adaptiveRate, tally, settings)
+	return rl.adaptiveRate
+}
@@ -0,0 +1,174 @@
+package rate_limiter
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLocalRateLimiter(t *testing.T) *LocalRateLimiter {
+	t.Helper()
+	rl, err := NewLocalRateLimiter(1000, time.Minute, time.Hour, AlgorithmConfig{}, Limits{})
+	if err != nil {
+		t.Fatalf("NewLocalRateLimiter: %v", err)
+	}
+	t.Cleanup(rl.Stop)
+	return rl
+}
+
+func TestLocalAllowRequestLevels(t *testing.T) {
+	// The refill rate is low enough for the token bucket to get nothing back during the test
+	tokenBucket := func(capacity int) Rule {
+		return Rule{Name: "token-bucket", Capacity: capacity, RefillRate: 0.001}
+	}
+	slidingLog := func(capacity int) Rule {
+		return Rule{Name: "sliding-log", Capacity: capacity, Algorithm: SlidingWindowLog, Window: time.Minute}
+	}
+	slidingCounter := func(capacity int) Rule {
+		return Rule{Name: "sliding-counter", Capacity: capacity, Algorithm: SlidingWindowCounter, Window: time.Hour}
+	}
+	fixedWindow := func(capacity int) Rule {
+		return Rule{Name: "fixed-window", Capacity: capacity, Algorithm: FixedWindow, WindowUnit: WindowHour}
+	}
+
+	tests := []struct {
+		name          string
+		rules         []Rule
+		before        int // Requests of one token allowed before
+		tokens        int
+		wantRejected  int
+		wantRemaining int
+	}{
+		{
+			name:          "every level has room",
+			rules:         []Rule{tokenBucket(5), slidingLog(4), slidingCounter(5), fixedWindow(5)},
+			tokens:        1,
+			wantRejected:  -1,
+			wantRemaining: 3,
+		},
+		{
+			name:         "first level rejects",
+			rules:        []Rule{tokenBucket(1), slidingLog(5), slidingCounter(5), fixedWindow(5)},
+			before:       1,
+			tokens:       1,
+			wantRejected: 0,
+		},
+		{
+			name:          "costly request rejected by a middle level",
+			rules:         []Rule{tokenBucket(5), slidingLog(3), slidingCounter(5), fixedWindow(5)},
+			before:        1,
+			tokens:        3,
+			wantRejected:  1,
+			wantRemaining: 2,
+		},
+		{
+			name:         "last level rejects",
+			rules:        []Rule{tokenBucket(5), slidingLog(5), slidingCounter(5), fixedWindow(2)},
+			before:       2,
+			tokens:       1,
+			wantRejected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newTestLocalRateLimiter(t)
+			levels := ruleLevels("user", tt.rules)
+
+			for i := 0; i < tt.before; i++ {
+				if result, rejected := rl.AllowRequestLevels(levels, 1); !result.Allowed {
+					t.Fatalf("request %d was rejected by level %d", i, rejected)
+				}
+			}
+
+			// Tokens left in every level, read without taking any
+			remaining := func() []int {
+				left := make([]int, len(levels))
+				for i, level := range levels {
+					rule := level.Rule
+					left[i] = rl.getBucket(ruleID(level.ID, rule), rule.Capacity, rule.RefillRate, rule.algorithmConfig()).Check(0).Remaining
+				}
+				return left
+			}
+			before := remaining()
+
+			result, rejected := rl.AllowRequestLevels(levels, tt.tokens)
+			if rejected != tt.wantRejected || result.Allowed != (tt.wantRejected == -1) {
+				t.Fatalf("allowed, rejected = %v, %d, want %v, %d", result.Allowed, rejected, tt.wantRejected == -1, tt.wantRejected)
+			}
+			if result.Remaining != tt.wantRemaining {
+				t.Errorf("remaining = %d, want %d", result.Remaining, tt.wantRemaining)
+			}
+
+			// A rejected request takes nothing from any level
+			if !result.Allowed {
+				if after := remaining(); fmt.Sprint(after) != fmt.Sprint(before) {
+					t.Errorf("remaining tokens went from %v to %v", before, after)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalAllowRequestLevelsConcurrent(t *testing.T) {
+	rl := newTestLocalRateLimiter(t)
+	org := Level{ID: "org", Rule: Rule{Name: "org", Capacity: 10, RefillRate: 0.001}}
+
+	// Five users of three requests each share the ten requests of their organisation,
+	// half of the requests list the levels the other way around
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for user := 0; user < 5; user++ {
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(user, i int) {
+				defer wg.Done()
+				key := Level{ID: fmt.Sprintf("user-%d", user), Rule: Rule{Name: "key", Capacity: 3, RefillRate: 0.001}}
+				levels := []Level{org, key}
+				if i%2 == 1 {
+					levels = []Level{key, org}
+				}
+				if result, _ := rl.AllowRequestLevels(levels, 1); result.Allowed {
+					allowed.Add(1)
+				}
+			}(user, i)
+		}
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != 10 {
+		t.Errorf("%d requests allowed, want the 10 of the organisation", got)
+	}
+}
+
+func TestLocalAcquireSlot(t *testing.T) {
+	rl := newTestLocalRateLimiter(t)
+
+	release, ok := rl.AcquireSlot("user", 1, 2)
+	if !ok {
+		t.Fatal("AcquireSlot = false, want a slot")
+	}
+	if _, ok := rl.AcquireSlot("user", 1, 2); ok {
+		t.Fatal("AcquireSlot took a second slot of the key")
+	}
+	other, ok := rl.AcquireSlot("other", 1, 2)
+	if !ok {
+		t.Fatal("AcquireSlot of another key = false, want a slot")
+	}
+	if _, ok := rl.AcquireSlot("third", 1, 2); ok {
+		t.Fatal("AcquireSlot went over the global limit")
+	}
+
+	// Giving a slot back twice frees it only once
+	release()
+	release()
+	if _, ok := rl.AcquireSlot("user", 1, 2); !ok {
+		t.Fatal("AcquireSlot of a released slot = false, want a slot")
+	}
+	if _, ok := rl.AcquireSlot("third", 1, 2); ok {
+		t.Fatal("AcquireSlot went over the global limit after a double release")
+	}
+	other()
+}
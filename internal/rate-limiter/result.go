@@ -0,0 +1,8 @@
+package rate_limiter
+
+import "github.com/krishpatel023/ratelimiter/internal/result"
+
+// Result holds the outcome of a rate limit check along with the state of the bucket after it
+// Limit, Remaining, RetryAfter and ResetAfter are exact for TokenBucket, GCRA, SlidingWindowLog and
+// FixedWindow. SlidingWindowCounter estimates them from its weighted count, like its limit
+type Result = result.Result
@@ -0,0 +1,76 @@
+package rate_limiter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rule is one of several limits a request group is held to at the same time,
+// e.g. 5 requests per second, 1,000 per hour and 20,000 per day
+type Rule struct {
+	Name       string         // Names the bucket of the rule - must be unique among the rules of a key
+	Capacity   int            // Tokens in the bucket, or requests per window for the window based algorithms
+	RefillRate float64        // Tokens added per second - used by TokenBucket and GCRA
+	Algorithm  Algorithm      // Algorithm of the rule - defaults to TokenBucket
+	Window     time.Duration  // Length of the window - used by the window based algorithms
+	WindowUnit WindowUnit     // Calendar unit the FixedWindow windows align to - takes precedence over Window
+	Location   *time.Location // Time zone of the calendar windows - defaults to UTC
+}
+
+// Level is a rule applied to one of the keys of a request
+// Levels let a request draw from the buckets of several keys at once, e.g. the bucket of its user
+// and a bucket shared by the whole organisation of the user
+type Level struct {
+	ID   string // Key of the request at this level
+	Rule Rule   // Limit of the key - the rule name tells the levels apart
+}
+
+// ruleLevels puts every rule of a request group on the same key
+func ruleLevels(id string, rules []Rule) []Level {
+	levels := make([]Level, len(rules))
+	for i, rule := range rules {
+		levels[i] = Level{ID: id, Rule: rule}
+	}
+	return levels
+}
+
+// algorithmConfig returns the algorithm settings of the rule
+func (r Rule) algorithmConfig() AlgorithmConfig {
+	return AlgorithmConfig{
+		Algorithm:  r.Algorithm,
+		Window:     r.Window,
+		WindowUnit: r.WindowUnit,
+		Location:   r.Location,
+	}.withDefaults()
+}
+
+// ValidateRules checks that every rule has a unique name, a known algorithm and the limits it needs
+func ValidateRules(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d: name is empty", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Capacity <= 0 {
+			return fmt.Errorf("rule %q: capacity must be greater than zero", rule.Name)
+		}
+		algorithm := rule.algorithmConfig()
+		if err := algorithm.validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if (algorithm.Algorithm == TokenBucket || algorithm.Algorithm == GCRA) && rule.RefillRate <= 0 {
+			return fmt.Errorf("rule %q: algorithm %q requires a refill rate greater than zero", rule.Name, algorithm.Algorithm)
+		}
+	}
+	return nil
+}
+
+// ruleID returns the id of the bucket of a rule - every rule of a request group gets its own bucket
+func ruleID(id string, rule Rule) string {
+	return id + ":rule:" + rule.Name
+}
@@ -0,0 +1,13 @@
+package result
+
+import "time"
+
+// Result holds the outcome of a rate limit check along with the state of the bucket after it
+// It is returned by the buckets of every algorithm, in memory and in Redis
+type Result struct {
+	Allowed    bool          // Whether the request is allowed
+	Limit      int           // Capacity of the bucket the result describes
+	Remaining  int           // Tokens that can still be spent right away
+	RetryAfter time.Duration // Time until the request would be allowed - zero if it was allowed
+	ResetAfter time.Duration // Time until the bucket is back to full capacity
+}
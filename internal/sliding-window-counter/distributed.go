@@ -0,0 +1,77 @@
+package sliding_window_counter
+
+func SlidingWindowCounterLuaScript() string {
+	// Lua script for atomic operations
+	// The whole state lives in one small hash: the start of the current window and the
+	// counts of the current and previous windows. Windows are aligned to the Unix epoch,
+	// so every instance agrees on where a window starts.
+	// Times are returned in microseconds: {allowed, remaining, retry_after, reset_after}
+	script := `
+	local counter_key = KEYS[1]
+	local tokens_requested = tonumber(ARGV[1])
+	local limit = tonumber(ARGV[2])
+	local window = tonumber(ARGV[3])
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+	local window_start = now - (now % window)
+
+	-- Get current counter state
+	local state = redis.call('HMGET', counter_key, 'start', 'current', 'previous')
+	local start = tonumber(state[1]) or window_start
+	local current = tonumber(state[2]) or 0
+	local previous = tonumber(state[3]) or 0
+
+	-- Move to the new window, the previous count only carries over if the windows are adjacent
+	if start ~= window_start then
+		if window_start - start == window then
+			previous = current
+		else
+			previous = 0
+		end
+		current = 0
+	end
+
+	-- Weight the previous window by the part of it still inside the rolling window
+	local weight = 1 - ((now - window_start) / window)
+	local estimated = previous * weight + current
+
+	local allowed = 0
+	local retry_after = 0
+	if estimated + tokens_requested <= limit then
+		current = current + tokens_requested
+		estimated = estimated + tokens_requested
+		allowed = 1
+	end
+
+	-- The estimate drops to zero once both counted windows are out of the rolling window
+	local reset_after = 0
+	if current > 0 then
+		reset_after = window_start + 2 * window - now
+	elseif previous > 0 then
+		reset_after = window_start + window - now
+	end
+
+	-- A rejected request fits once the previous window fades out enough,
+	-- or the current window becomes the previous one and fades out in turn
+	if allowed == 0 then
+		local room = limit - tokens_requested
+		if room < 0 then
+			retry_after = reset_after
+		elseif current <= room then
+			local fade = 1 - (room - current) / previous
+			retry_after = math.ceil(window_start + fade * window - now)
+		else
+			local fade = 1 - room / current
+			retry_after = math.ceil(window_start + window + fade * window - now)
+		end
+	end
+
+	redis.call('HSET', counter_key, 'start', window_start, 'current', current, 'previous', previous)
+	-- The state is useless once both windows are over
+	redis.call('PEXPIRE', counter_key, math.ceil(window * 2 / 1000))
+
+	return {allowed, math.max(0, math.floor(limit - estimated)), retry_after, reset_after}
+	`
+	return script
+}
@@ -0,0 +1,101 @@
+package sliding_window_counter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSlidingWindowCounterLuaScript(t *testing.T) {
+	const window = 60 * time.Second
+	start := time.Unix(1699999980, 0) // Start of a window - the windows are aligned to the Unix epoch
+
+	type request struct {
+		at     time.Duration // Time of the request after start
+		tokens int
+	}
+	tests := []struct {
+		name    string
+		limit   int
+		before  []request // Requests allowed before
+		request request
+		want    []int64 // {allowed, remaining, retry_after, reset_after} in microseconds
+	}{
+		{
+			name:    "empty window",
+			limit:   10,
+			request: request{at: 0, tokens: 1},
+			want:    []int64{1, 9, 0, (2 * window).Microseconds()},
+		},
+		{
+			name:    "previous window is weighted by its overlap",
+			limit:   10,
+			before:  []request{{at: 0, tokens: 8}},
+			request: request{at: 75 * time.Second, tokens: 1},
+			// 8 * 75% + 1 = 7
+			want: []int64{1, 3, 0, (105 * time.Second).Microseconds()},
+		},
+		{
+			name:    "rejected until the previous window fades out",
+			limit:   10,
+			before:  []request{{at: 0, tokens: 8}, {at: 61 * time.Second, tokens: 2}},
+			request: request{at: 75 * time.Second, tokens: 3},
+			// 8 * 75% + 2 + 3 = 11, 8 * (1 - 37.5%) + 2 + 3 = 10
+			want: []int64{0, 2, (7500 * time.Millisecond).Microseconds(), (105 * time.Second).Microseconds()},
+		},
+		{
+			name:    "rejected until the current window fades out in the next one",
+			limit:   10,
+			before:  []request{{at: 0, tokens: 10}},
+			request: request{at: 30 * time.Second, tokens: 2},
+			// 10 * (1 - 20%) + 2 = 10
+			want: []int64{0, 0, (42 * time.Second).Microseconds(), (90 * time.Second).Microseconds()},
+		},
+		{
+			name:    "windows that are not adjacent start over",
+			limit:   10,
+			before:  []request{{at: 0, tokens: 10}},
+			request: request{at: 150 * time.Second, tokens: 10},
+			want:    []int64{1, 0, 0, (90 * time.Second).Microseconds()},
+		},
+		{
+			name:    "request larger than the limit",
+			limit:   10,
+			request: request{at: 0, tokens: 11},
+			want:    []int64{0, 10, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			run := func(req request) []int64 {
+				server.SetTime(start.Add(req.at))
+				args := []interface{}{req.tokens, tt.limit, window.Microseconds()}
+				values, err := client.Eval(context.Background(), SlidingWindowCounterLuaScript(), []string{"counter"}, args...).Int64Slice()
+				if err != nil {
+					t.Fatalf("Eval: %v", err)
+				}
+				return values
+			}
+
+			for i, req := range tt.before {
+				if values := run(req); values[0] != 1 {
+					t.Fatalf("request %d was rejected: %v", i, values)
+				}
+			}
+			got := run(tt.request)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
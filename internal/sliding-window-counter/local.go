@@ -0,0 +1,122 @@
+package sliding_window_counter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/result"
+)
+
+// SlidingWindowCounter approximates a rolling window with two counters
+// The count of the previous window is weighted by how much of it still overlaps the
+// rolling window and added to the count of the current window
+type SlidingWindowCounter struct {
+	mu            sync.Mutex
+	limit         int           // Maximum number of requests in any window
+	window        time.Duration // Length of each window
+	currentStart  time.Time     // Start of the current window
+	currentCount  int           // Requests allowed in the current window
+	previousCount int           // Requests allowed in the previous window
+}
+
+func NewSlidingWindowCounter(limit int, window time.Duration) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		limit:        limit,
+		window:       window,
+		currentStart: time.Now().Truncate(window),
+	}
+}
+
+// advance moves the counters forward when the current window is over
+// The caller must hold sw.mu
+func (sw *SlidingWindowCounter) advance(now time.Time) {
+	windowStart := now.Truncate(sw.window)
+	if !windowStart.After(sw.currentStart) {
+		return
+	}
+
+	// The current window becomes the previous one only if the two are adjacent,
+	// otherwise a whole window went by without requests
+	if windowStart.Sub(sw.currentStart) == sw.window {
+		sw.previousCount = sw.currentCount
+	} else {
+		sw.previousCount = 0
+	}
+	sw.currentCount = 0
+	sw.currentStart = windowStart
+}
+
+// It will check if the request fits in the estimated rolling window
+func (sw *SlidingWindowCounter) AllowRequest(tokens int) result.Result {
+	return sw.decide(tokens, true)
+}
+
+// Check tells if the request would be allowed without counting it
+func (sw *SlidingWindowCounter) Check(tokens int) result.Result {
+	return sw.decide(tokens, false)
+}
+
+// decide checks the request and counts it when it is allowed and take is set
+func (sw *SlidingWindowCounter) decide(tokens int, take bool) result.Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now()
+	sw.advance(now)
+
+	weight := 1 - float64(now.Sub(sw.currentStart))/float64(sw.window)
+	estimated := float64(sw.previousCount)*weight + float64(sw.currentCount)
+
+	allowed := estimated+float64(tokens) <= float64(sw.limit)
+	if allowed && take {
+		sw.currentCount += tokens
+		estimated += float64(tokens)
+	}
+
+	res := result.Result{
+		Allowed:   allowed,
+		Limit:     sw.limit,
+		Remaining: max(0, int(math.Floor(float64(sw.limit)-estimated))),
+	}
+
+	// The estimate drops to zero once both counted windows are out of the rolling window
+	switch {
+	case sw.currentCount > 0:
+		res.ResetAfter = sw.currentStart.Add(2 * sw.window).Sub(now)
+	case sw.previousCount > 0:
+		res.ResetAfter = sw.currentStart.Add(sw.window).Sub(now)
+	}
+	if !allowed {
+		res.RetryAfter = sw.retryAfter(now, tokens, res.ResetAfter)
+	}
+	return res
+}
+
+// retryAfter estimates when the weighted count leaves room for the request
+// Either the previous window fades out enough, or the current one has to become the previous one first.
+// The caller must hold sw.mu
+func (sw *SlidingWindowCounter) retryAfter(now time.Time, tokens int, resetAfter time.Duration) time.Duration {
+	room := float64(sw.limit - tokens)
+	switch {
+	case room < 0:
+		return resetAfter
+	case float64(sw.currentCount) <= room:
+		// previous * weight must drop to the room left by the current window
+		weight := (room - float64(sw.currentCount)) / float64(sw.previousCount)
+		return sw.currentStart.Add(time.Duration((1 - weight) * float64(sw.window))).Sub(now)
+	default:
+		// In the next window the current count fades out the same way
+		weight := room / float64(sw.currentCount)
+		return sw.currentStart.Add(sw.window + time.Duration((1-weight)*float64(sw.window))).Sub(now)
+	}
+}
+
+// SetLimits changes the number of requests allowed per window
+// The requests already counted stay in the window, the refill rate is not used
+func (sw *SlidingWindowCounter) SetLimits(capacity int, refillRate float64) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.limit = capacity
+}
@@ -0,0 +1,110 @@
+package sliding_window_counter
+
+import (
+	"testing"
+	"time"
+)
+
+// within reports if got is within 20ms of want - the counter reads the clock itself
+func within(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -20*time.Millisecond && diff < 20*time.Millisecond
+}
+
+func TestSlidingWindowCounterAllowRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		current       int // Requests already counted in the current window
+		tokens        int
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{name: "empty window", limit: 3, tokens: 1, wantAllowed: true, wantRemaining: 2},
+		{name: "last slot", limit: 3, current: 2, tokens: 1, wantAllowed: true, wantRemaining: 0},
+		{name: "full window", limit: 3, current: 3, tokens: 1, wantAllowed: false, wantRemaining: 0},
+		{name: "costly request", limit: 5, current: 3, tokens: 3, wantAllowed: false, wantRemaining: 2},
+		{name: "request larger than the limit", limit: 2, tokens: 3, wantAllowed: false, wantRemaining: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw := NewSlidingWindowCounter(tt.limit, time.Hour)
+			sw.currentCount = tt.current
+
+			res := sw.AllowRequest(tt.tokens)
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Limit != tt.limit || res.Remaining != tt.wantRemaining {
+				t.Errorf("limit, remaining = %d, %d, want %d, %d", res.Limit, res.Remaining, tt.limit, tt.wantRemaining)
+			}
+
+			// Both counted windows are out of the rolling window at the end of the next one
+			wantReset := time.Duration(0)
+			if sw.currentCount > 0 {
+				wantReset = time.Until(sw.currentStart.Add(2 * time.Hour))
+			}
+			if !within(res.ResetAfter, wantReset) {
+				t.Errorf("reset after = %v, want %v", res.ResetAfter, wantReset)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowCounterAdvance(t *testing.T) {
+	start := time.Unix(1699999980, 0)
+
+	tests := []struct {
+		name         string
+		at           time.Duration // Time of the request after the start of the current window
+		wantStart    time.Duration
+		wantCurrent  int
+		wantPrevious int
+	}{
+		{name: "same window", at: 30 * time.Second, wantStart: 0, wantCurrent: 5, wantPrevious: 3},
+		{name: "next window", at: 70 * time.Second, wantStart: time.Minute, wantCurrent: 0, wantPrevious: 5},
+		{name: "a whole window without requests", at: 130 * time.Second, wantStart: 2 * time.Minute, wantCurrent: 0, wantPrevious: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw := &SlidingWindowCounter{limit: 10, window: time.Minute, currentStart: start, currentCount: 5, previousCount: 3}
+			sw.advance(start.Add(tt.at))
+
+			if !sw.currentStart.Equal(start.Add(tt.wantStart)) || sw.currentCount != tt.wantCurrent || sw.previousCount != tt.wantPrevious {
+				t.Errorf("start, current, previous = %v, %d, %d, want %v, %d, %d",
+					sw.currentStart.Sub(start), sw.currentCount, sw.previousCount, tt.wantStart, tt.wantCurrent, tt.wantPrevious)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowCounterRetryAfter(t *testing.T) {
+	start := time.Unix(1699999980, 0)
+	now := start.Add(15 * time.Second)
+
+	tests := []struct {
+		name     string
+		current  int
+		previous int
+		tokens   int
+		want     time.Duration
+	}{
+		// 8 * (1 - 37.5%) + 2 + 3 = 10
+		{name: "previous window fades out", current: 2, previous: 8, tokens: 3, want: 7500 * time.Millisecond},
+		// 10 * (1 - 20%) + 2 = 10 in the next window
+		{name: "current window fades out in the next one", current: 10, tokens: 2, want: 57 * time.Second},
+		{name: "request larger than the limit", current: 1, tokens: 11, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw := &SlidingWindowCounter{limit: 10, window: time.Minute, currentStart: start, currentCount: tt.current, previousCount: tt.previous}
+
+			if got := sw.retryAfter(now, tt.tokens, time.Minute); !within(got, tt.want) {
+				t.Errorf("retry after = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package sliding_window_log
+
+func SlidingWindowLogLuaScript() string {
+	// Lua script for atomic operations
+	// The log is kept in a sorted set scored by the request time in microseconds.
+	// Entries older than the window are trimmed before counting, and every allowed
+	// request adds one member per token. The member suffix passed in ARGV[4] keeps
+	// members unique when several requests land on the same microsecond.
+	// Times are returned in microseconds: {allowed, remaining, retry_after, reset_after}
+	script := `
+	local log_key = KEYS[1]
+	local tokens_requested = tonumber(ARGV[1])
+	local limit = tonumber(ARGV[2])
+	local window = tonumber(ARGV[3])
+	local member = ARGV[4]
+
+	local now = redis.call('TIME')
+	now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+
+	-- Drop the requests that fell out of the window
+	redis.call('ZREMRANGEBYSCORE', log_key, '-inf', now - window)
+
+	local allowed = 0
+	local count = redis.call('ZCARD', log_key)
+	if count + tokens_requested <= limit then
+		for i = 1, tokens_requested do
+			redis.call('ZADD', log_key, now, member .. ':' .. i)
+		end
+		count = count + tokens_requested
+		allowed = 1
+	end
+
+	-- The window is empty again once the newest entry falls out of it
+	local reset_after = 0
+	local newest = redis.call('ZRANGE', log_key, -1, -1, 'WITHSCORES')
+	if newest[2] then
+		reset_after = tonumber(newest[2]) + window - now
+	end
+
+	-- A rejected request fits once enough of the oldest entries fall out of the window
+	local retry_after = 0
+	if allowed == 0 then
+		retry_after = reset_after
+		local expire = count + tokens_requested - limit
+		if tokens_requested <= limit and expire > 0 then
+			local entry = redis.call('ZRANGE', log_key, expire - 1, expire - 1, 'WITHSCORES')
+			if entry[2] then
+				retry_after = tonumber(entry[2]) + window - now
+			end
+		end
+	end
+
+	-- Nothing in the log outlives the window
+	redis.call('PEXPIRE', log_key, math.ceil(window / 1000))
+
+	return {allowed, math.max(0, limit - count), retry_after, reset_after}
+	`
+	return script
+}
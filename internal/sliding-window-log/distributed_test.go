@@ -0,0 +1,94 @@
+package sliding_window_log
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSlidingWindowLogLuaScript(t *testing.T) {
+	const window = 60 * time.Second
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		limit  int
+		before []time.Duration // Times of the requests allowed before, after start
+		at     time.Duration   // Time of the checked request, after start
+		tokens int
+		want   []int64 // {allowed, remaining, retry_after, reset_after} in microseconds
+	}{
+		{
+			name:   "empty log",
+			limit:  3,
+			tokens: 1,
+			want:   []int64{1, 2, 0, window.Microseconds()},
+		},
+		{
+			name:   "full log waits for the oldest entry",
+			limit:  3,
+			before: []time.Duration{0, 5 * time.Second, 9 * time.Second},
+			at:     10 * time.Second,
+			tokens: 1,
+			want:   []int64{0, 0, (50 * time.Second).Microseconds(), (59 * time.Second).Microseconds()},
+		},
+		{
+			name:   "entries out of the window are dropped",
+			limit:  2,
+			before: []time.Duration{0, 30 * time.Second},
+			at:     window,
+			tokens: 1,
+			want:   []int64{1, 0, 0, window.Microseconds()},
+		},
+		{
+			name:   "costly request waits for as many entries as it is missing",
+			limit:  4,
+			before: []time.Duration{0, 10 * time.Second, 20 * time.Second},
+			at:     30 * time.Second,
+			tokens: 2,
+			want:   []int64{0, 1, (30 * time.Second).Microseconds(), (50 * time.Second).Microseconds()},
+		},
+		{
+			name:   "request larger than the limit",
+			limit:  2,
+			before: []time.Duration{0},
+			at:     10 * time.Second,
+			tokens: 3,
+			want:   []int64{0, 1, (50 * time.Second).Microseconds(), (50 * time.Second).Microseconds()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			defer client.Close()
+
+			run := func(i int, at time.Duration, tokens int) []int64 {
+				server.SetTime(start.Add(at))
+				args := []interface{}{tokens, tt.limit, window.Microseconds(), "member-" + strconv.Itoa(i)}
+				values, err := client.Eval(context.Background(), SlidingWindowLogLuaScript(), []string{"log"}, args...).Int64Slice()
+				if err != nil {
+					t.Fatalf("Eval: %v", err)
+				}
+				return values
+			}
+
+			for i, at := range tt.before {
+				if values := run(i, at, 1); values[0] != 1 {
+					t.Fatalf("request %d was rejected: %v", i, values)
+				}
+			}
+			got := run(len(tt.before), tt.at, tt.tokens)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package sliding_window_log
+
+import (
+	"sync"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/result"
+)
+
+// SlidingWindowLog keeps the timestamp of every allowed request and allows a new request
+// only if fewer than limit requests were allowed in the last window
+type SlidingWindowLog struct {
+	mu     sync.Mutex
+	limit  int           // Maximum number of requests in any window
+	window time.Duration // Length of the rolling window
+	log    []time.Time   // Timestamps of the allowed requests, oldest first
+}
+
+func NewSlidingWindowLog(limit int, window time.Duration) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		limit:  limit,
+		window: window,
+		log:    make([]time.Time, 0, limit),
+	}
+}
+
+// evict drops the timestamps that fell out of the window
+// The caller must hold sw.mu
+func (sw *SlidingWindowLog) evict(now time.Time) {
+	i := 0
+	for i < len(sw.log) && now.Sub(sw.log[i]) >= sw.window {
+		i++
+	}
+	if i > 0 {
+		sw.log = append(sw.log[:0], sw.log[i:]...)
+	}
+}
+
+// It will check if the request fits in the current window
+// A request costing more than one token takes one slot of the log per token
+func (sw *SlidingWindowLog) AllowRequest(tokens int) result.Result {
+	return sw.decide(tokens, true)
+}
+
+// Check tells if the request would be allowed without logging it
+func (sw *SlidingWindowLog) Check(tokens int) result.Result {
+	return sw.decide(tokens, false)
+}
+
+// decide checks the request and logs it when it is allowed and take is set
+func (sw *SlidingWindowLog) decide(tokens int, take bool) result.Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	now := time.Now()
+	sw.evict(now)
+
+	allowed := len(sw.log)+tokens <= sw.limit
+	if allowed && take {
+		for i := 0; i < tokens; i++ {
+			sw.log = append(sw.log, now)
+		}
+	}
+
+	res := result.Result{
+		Allowed:   allowed,
+		Limit:     sw.limit,
+		Remaining: max(0, sw.limit-len(sw.log)),
+	}
+	if len(sw.log) > 0 {
+		// The window is empty again once the newest entry falls out of it
+		res.ResetAfter = sw.log[len(sw.log)-1].Add(sw.window).Sub(now)
+	}
+	if !allowed {
+		// The request fits once enough of the oldest entries fall out of the window
+		res.RetryAfter = res.ResetAfter
+		if expire := len(sw.log) + tokens - sw.limit; tokens <= sw.limit && expire > 0 {
+			res.RetryAfter = sw.log[expire-1].Add(sw.window).Sub(now)
+		}
+	}
+	return res
+}
+
+// SetLimits changes the number of requests allowed per window
+// The requests already counted stay in the window, the refill rate is not used
+func (sw *SlidingWindowLog) SetLimits(capacity int, refillRate float64) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.limit = capacity
+}
@@ -0,0 +1,123 @@
+package sliding_window_log
+
+import (
+	"testing"
+	"time"
+)
+
+// within reports if got is within 20ms of want - the bucket reads the clock itself
+func within(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -20*time.Millisecond && diff < 20*time.Millisecond
+}
+
+func TestSlidingWindowLogAllowRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		window        time.Duration
+		logged        []time.Duration // Age of the entries already in the log, oldest first
+		tokens        int
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+		wantReset     time.Duration
+	}{
+		{
+			name:          "empty log",
+			limit:         3,
+			window:        time.Minute,
+			tokens:        1,
+			wantAllowed:   true,
+			wantRemaining: 2,
+			wantReset:     time.Minute,
+		},
+		{
+			name:          "last slot",
+			limit:         3,
+			window:        time.Minute,
+			logged:        []time.Duration{10 * time.Second, 5 * time.Second},
+			tokens:        1,
+			wantAllowed:   true,
+			wantRemaining: 0,
+			wantReset:     time.Minute,
+		},
+		{
+			name:        "full log waits for the oldest entry",
+			limit:       3,
+			window:      time.Minute,
+			logged:      []time.Duration{10 * time.Second, 5 * time.Second, time.Second},
+			tokens:      1,
+			wantAllowed: false,
+			wantRetry:   50 * time.Second,
+			wantReset:   59 * time.Second,
+		},
+		{
+			name:          "entries out of the window are dropped",
+			limit:         2,
+			window:        time.Minute,
+			logged:        []time.Duration{70 * time.Second, 5 * time.Second},
+			tokens:        1,
+			wantAllowed:   true,
+			wantRemaining: 0,
+			wantReset:     time.Minute,
+		},
+		{
+			name:          "costly request waits for as many entries as it is missing",
+			limit:         4,
+			window:        time.Minute,
+			logged:        []time.Duration{30 * time.Second, 20 * time.Second, 10 * time.Second},
+			tokens:        2,
+			wantAllowed:   false,
+			wantRemaining: 1,
+			wantRetry:     30 * time.Second,
+			wantReset:     50 * time.Second,
+		},
+		{
+			name:          "request larger than the limit",
+			limit:         2,
+			window:        time.Minute,
+			tokens:        3,
+			wantAllowed:   false,
+			wantRemaining: 2,
+			wantRetry:     0,
+			wantReset:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw := NewSlidingWindowLog(tt.limit, tt.window)
+			now := time.Now()
+			for _, age := range tt.logged {
+				sw.log = append(sw.log, now.Add(-age))
+			}
+
+			res := sw.AllowRequest(tt.tokens)
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Limit != tt.limit || res.Remaining != tt.wantRemaining {
+				t.Errorf("limit, remaining = %d, %d, want %d, %d", res.Limit, res.Remaining, tt.limit, tt.wantRemaining)
+			}
+			if !within(res.RetryAfter, tt.wantRetry) {
+				t.Errorf("retry after = %v, want %v", res.RetryAfter, tt.wantRetry)
+			}
+			if !within(res.ResetAfter, tt.wantReset) {
+				t.Errorf("reset after = %v, want %v", res.ResetAfter, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowLogCheck(t *testing.T) {
+	sw := NewSlidingWindowLog(2, time.Minute)
+
+	if res := sw.Check(2); !res.Allowed || len(sw.log) != 0 {
+		t.Fatalf("Check allowed = %v with %d entries, want true with none", res.Allowed, len(sw.log))
+	}
+	sw.AllowRequest(1)
+	if res := sw.Check(2); res.Allowed || len(sw.log) != 1 {
+		t.Fatalf("Check allowed = %v with %d entries, want false with 1", res.Allowed, len(sw.log))
+	}
+}
@@ -7,10 +7,10 @@ import (
 type DistributedTokenBucket struct {
 	client     *redis.Client
 	capacity   int
-	refillRate int
+	refillRate float64
 }
 
-func NewDistributedTokenBucket(client *redis.Client, capacity, refillRate int) *DistributedTokenBucket {
+func NewDistributedTokenBucket(client *redis.Client, capacity int, refillRate float64) *DistributedTokenBucket {
 	return &DistributedTokenBucket{
 		client:     client,
 		capacity:   capacity,
@@ -20,7 +20,8 @@ func NewDistributedTokenBucket(client *redis.Client, capacity, refillRate int) *
 
 func TokenBucketLuaScript() string {
 	//Lua script for atomic operations
-	// It takes care of token verification, refill and request verification
+	// It takes care of token verification, refill and request verification.
+	// Times are returned in microseconds: {allowed, remaining, retry_after, reset_after}
 	script := `
 	local bucket_key = KEYS[1]
 	local tokens_requested = tonumber(ARGV[1])
@@ -55,9 +56,17 @@ func TokenBucketLuaScript() string {
 	
 	-- Check if enough tokens
 	local allowed = 0
+	local retry_after = 0
 	if current_tokens >= tokens_requested then
 		current_tokens = current_tokens - tokens_requested
 		allowed = 1
+	elseif refill_rate > 0 then
+		retry_after = math.ceil((tokens_requested - current_tokens) / refill_rate * 1000000)
+	end
+
+	local reset_after = 0
+	if refill_rate > 0 then
+		reset_after = math.ceil((total_tokens - current_tokens) / refill_rate * 1000000)
 	end
 	
 	-- Update bucket state
@@ -70,7 +79,7 @@ func TokenBucketLuaScript() string {
 		redis.call('SET', bucket_key .. ':last_refill', now)
 	end
 	
-	return allowed
+	return {allowed, math.floor(current_tokens), retry_after, reset_after}
 	`
 	return script
 }
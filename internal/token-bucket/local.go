@@ -1,51 +1,102 @@
 package token_bucket
 
 import (
+	"math"
 	"sync"
 	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/result"
 )
 
 type TokenBucket struct {
 	mu             sync.Mutex
-	capacity       int // Maximum number of tokens in the bucket
-	refillRate     int // Number of tokens to add per second
-	currentFill    int // Current number of tokens in the bucket
+	capacity       float64 // Maximum number of tokens in the bucket
+	refillRate     float64 // Number of tokens to add per second, can be fractional
+	currentFill    float64 // Current number of tokens in the bucket, including partially refilled tokens
 	lastRefillTime time.Time
 }
 
-func NewTokenBucket(capacity, refillRate int) *TokenBucket {
+func NewTokenBucket(capacity int, refillRate float64) *TokenBucket {
 	return &TokenBucket{
-		capacity:       capacity,
+		capacity:       float64(capacity),
 		refillRate:     refillRate,
-		currentFill:    capacity,
+		currentFill:    float64(capacity),
 		lastRefillTime: time.Now(),
 	}
 }
 
+// refill adds the tokens earned since the last refill
+// Elapsed time is tracked with nanosecond precision and partial tokens are kept,
+// so a rate of 10 tokens/s adds a token every 100ms instead of 10 tokens once per second.
+// The caller must hold tb.mu
 func (tb *TokenBucket) refill() {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
-
 	now := time.Now()
-	elapsed := int(now.Sub(tb.lastRefillTime).Seconds()) // Convert to whole seconds
+	elapsed := now.Sub(tb.lastRefillTime).Seconds()
 
 	if elapsed > 0 {
-		tb.currentFill = min(tb.capacity, tb.currentFill+elapsed*tb.refillRate)
-		tb.lastRefillTime = now // Update last refill time only when tokens are added
+		tb.currentFill = math.Min(tb.capacity, tb.currentFill+elapsed*tb.refillRate)
+		tb.lastRefillTime = now
 	}
 }
 
 // It will check if the token is available or not
-// If the token is available, it will return true - allowing the request
-// Else, it will return false - denying the request
-func (tb *TokenBucket) AllowRequest(tokens int) bool {
+// If the token is available, it will take it and allow the request
+// Else, it will deny the request and tell how long until enough tokens are back
+func (tb *TokenBucket) AllowRequest(tokens int) result.Result {
+	return tb.decide(tokens, true)
+}
+
+// Check tells if the request would be allowed without taking its tokens
+func (tb *TokenBucket) Check(tokens int) result.Result {
+	return tb.decide(tokens, false)
+}
+
+// decide checks the request and takes its tokens when it is allowed and take is set
+func (tb *TokenBucket) decide(tokens int, take bool) result.Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
 	tb.refill()
+
+	allowed := tb.currentFill >= float64(tokens)
+	if allowed && take {
+		tb.currentFill -= float64(tokens)
+	}
+
+	res := result.Result{
+		Allowed:    allowed,
+		Limit:      int(tb.capacity),
+		Remaining:  int(math.Floor(tb.currentFill)),
+		ResetAfter: tb.timeToFill(tb.capacity),
+	}
+	if !allowed {
+		res.RetryAfter = tb.timeToFill(float64(tokens))
+	}
+	return res
+}
+
+// timeToFill returns how long the bucket takes to hold the tokens at the refill rate
+// The caller must hold tb.mu
+func (tb *TokenBucket) timeToFill(tokens float64) time.Duration {
+	missing := tokens - tb.currentFill
+	if missing <= 0 || tb.refillRate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(missing / tb.refillRate * float64(time.Second)))
+}
+
+// SetLimits changes the capacity and the refill rate of the bucket
+// The tokens earned up to now are added at the old rate first, and the tokens in the bucket
+// are kept - only cut down to a smaller capacity
+func (tb *TokenBucket) SetLimits(capacity int, refillRate float64) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
-	if tb.currentFill >= tokens {
-		tb.currentFill -= tokens
-		return true
+	if tb.capacity == float64(capacity) && tb.refillRate == refillRate {
+		return
 	}
-	return false
+	tb.refill()
+	tb.capacity = float64(capacity)
+	tb.refillRate = refillRate
+	tb.currentFill = math.Min(tb.capacity, tb.currentFill)
 }
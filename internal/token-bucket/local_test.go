@@ -0,0 +1,101 @@
+package token_bucket
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// fillWithin reports if the fill of the bucket is within what its rate adds in 20ms of want - the bucket reads the clock itself
+func fillWithin(tb *TokenBucket, want float64) bool {
+	return math.Abs(tb.currentFill-want) <= tb.refillRate*0.02+1e-9
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	tests := []struct {
+		name        string
+		capacity    int
+		refillRate  float64
+		fill        float64       // Tokens in the bucket at the last refill
+		elapsed     time.Duration // Time since the last refill
+		wantFill    float64
+		wantAllowed bool // Decision on a request of one token
+		wantRetry   time.Duration
+	}{
+		{name: "fractional rate keeps the partial token", capacity: 5, refillRate: 0.5, elapsed: time.Second, wantFill: 0.5, wantRetry: time.Second},
+		{name: "fractional rate completes the token", capacity: 5, refillRate: 0.5, fill: 0.5, elapsed: time.Second, wantFill: 1, wantAllowed: true},
+		{name: "sub-second refill adds one token", capacity: 10, refillRate: 10, elapsed: 100 * time.Millisecond, wantFill: 1, wantAllowed: true},
+		{name: "sub-second refill adds part of a token", capacity: 10, refillRate: 4, elapsed: 150 * time.Millisecond, wantFill: 0.6, wantRetry: 100 * time.Millisecond},
+		{name: "refill stops at the capacity", capacity: 3, refillRate: 10, fill: 2.5, elapsed: time.Second, wantFill: 3, wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucket(tt.capacity, tt.refillRate)
+			tb.currentFill = tt.fill
+			tb.lastRefillTime = time.Now().Add(-tt.elapsed)
+
+			res := tb.Check(1)
+			if !fillWithin(tb, tt.wantFill) {
+				t.Errorf("fill = %v, want %v", tb.currentFill, tt.wantFill)
+			}
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if diff := res.RetryAfter - tt.wantRetry; diff < -20*time.Millisecond || diff > 20*time.Millisecond {
+				t.Errorf("retry after = %v, want %v", res.RetryAfter, tt.wantRetry)
+			}
+			if res.Remaining != int(math.Floor(tt.wantFill)) {
+				t.Errorf("remaining = %d, want %d", res.Remaining, int(math.Floor(tt.wantFill)))
+			}
+		})
+	}
+}
+
+func TestTokenBucketAllowRequest(t *testing.T) {
+	tb := NewTokenBucket(3, 0.001)
+
+	// A costly request takes all its tokens, one that does not fit takes none
+	if res := tb.AllowRequest(2); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("first request = %+v, want allowed with 1 remaining", res)
+	}
+	if res := tb.AllowRequest(2); res.Allowed || res.Remaining != 1 {
+		t.Fatalf("second request = %+v, want rejected with 1 remaining", res)
+	}
+	if res := tb.Check(1); !res.Allowed || !fillWithin(tb, 1) {
+		t.Fatalf("check = %+v with fill %v, want allowed without taking the token", res, tb.currentFill)
+	}
+}
+
+func TestTokenBucketSetLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		fill       float64
+		elapsed    time.Duration // Time since the last refill at the old rate of 10 tokens per second
+		capacity   int
+		refillRate float64
+		wantFill   float64
+	}{
+		{name: "smaller capacity cuts the tokens", fill: 8, capacity: 5, refillRate: 10, wantFill: 5},
+		{name: "larger capacity keeps the tokens", fill: 4, capacity: 20, refillRate: 10, wantFill: 4},
+		{name: "tokens earned so far use the old rate", fill: 0, elapsed: 300 * time.Millisecond, capacity: 10, refillRate: 1, wantFill: 3},
+		{name: "same limits change nothing", fill: 2, capacity: 10, refillRate: 10, wantFill: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucket(10, 10)
+			tb.currentFill = tt.fill
+			tb.lastRefillTime = time.Now().Add(-tt.elapsed)
+
+			tb.SetLimits(tt.capacity, tt.refillRate)
+			if tb.capacity != float64(tt.capacity) || tb.refillRate != tt.refillRate {
+				t.Fatalf("capacity, refill rate = %v, %v, want %d, %v", tb.capacity, tb.refillRate, tt.capacity, tt.refillRate)
+			}
+			// The old rate of 10 tokens per second bounds the error
+			if math.Abs(tb.currentFill-tt.wantFill) > 0.2 {
+				t.Errorf("fill = %v, want %v", tb.currentFill, tt.wantFill)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package limiters
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
+)
+
+// AdaptiveConfig holds the settings of the adaptive mode
+// The refill rate drops multiplicatively when the target answers with a 5xx or slower than
+// LatencyThreshold, and grows back additively on healthy responses - up to the configured RefillRate.
+// It only applies to the TokenBucket and GCRA algorithms
+type AdaptiveConfig struct {
+	Enabled          bool          // Adjust the refill rate to the health of the target
+	MinRefillRate    float64       // Lowest refill rate the adaptive mode goes down to
+	DecreaseFactor   float64       // Refill rate multiplier on an unhealthy response - between 0 and 1
+	IncreaseStep     float64       // Tokens per second added back on a healthy response
+	LatencyThreshold time.Duration // Responses slower than this count as unhealthy - zero to ignore latency
+}
+
+// adjustFunc moves the adaptive refill rate after the responses of a tally and returns the new rate
+type adjustFunc func(ctx context.Context, tally adaptive.Tally, settings adaptive.Settings) (float64, error)
+
+const (
+	adaptiveBatchSize     = 20                     // Responses tallied before the refill rate is adjusted
+	adaptiveFlushInterval = 250 * time.Millisecond // Longest a response waits in the tally
+)
+
+// healthTally counts the responses of the target between two adjustments of the refill rate
+// The rate is adjusted once per batch of responses, or once the interval passed, instead of after
+// every response - the distributed limiter saves a Redis round trip on most responses
+type healthTally struct {
+	mu       sync.Mutex
+	tally    adaptive.Tally // Responses since the last adjustment
+	adjusted time.Time      // Time of the last adjustment
+}
+
+// record counts a response and returns the responses to adjust the rate with once the batch is full
+// or the interval since the last adjustment passed - false while the response waits in the tally
+func (t *healthTally) record(healthy bool, now time.Time) (adaptive.Tally, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if healthy {
+		t.tally.Healthy++
+	} else {
+		t.tally.Unhealthy++
+	}
+	if t.tally.Healthy+t.tally.Unhealthy < adaptiveBatchSize && now.Sub(t.adjusted) < adaptiveFlushInterval {
+		return adaptive.Tally{}, false
+	}
+
+	tally := t.tally
+	t.tally = adaptive.Tally{}
+	t.adjusted = now
+	return tally, true
+}
+
+// adaptiveRate holds the refill rate last returned by the rate limiter
+type adaptiveRate struct {
+	bits atomic.Uint64
+}
+
+func newAdaptiveRate(rate float64) *adaptiveRate {
+	r := &adaptiveRate{}
+	r.store(rate)
+	return r
+}
+
+func (r *adaptiveRate) load() float64 {
+	return math.Float64frombits(r.bits.Load())
+}
+
+func (r *adaptiveRate) store(rate float64) {
+	r.bits.Store(math.Float64bits(rate))
+}
+
+// statusRecorder keeps the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush streamed responses
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// healthy reports if a response shows a healthy target
+func (c AdaptiveConfig) healthy(status int, latency time.Duration) bool {
+	if status >= http.StatusInternalServerError {
+		return false
+	}
+	if c.LatencyThreshold > 0 && latency > c.LatencyThreshold {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package limiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
+)
+
+func TestHealthTallyRecord(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var tally healthTally
+
+	// The first response adjusts the rate right away
+	if got, full := tally.record(false, start); !full || got != (adaptive.Tally{Unhealthy: 1}) {
+		t.Fatalf("first response = %+v, %v, want one unhealthy response", got, full)
+	}
+
+	// The responses wait in the tally until the batch is full
+	now := start.Add(time.Millisecond)
+	for i := 1; i < adaptiveBatchSize; i++ {
+		if got, full := tally.record(i%4 != 0, now); full {
+			t.Fatalf("response %d adjusted the rate with %+v before the batch was full", i, got)
+		}
+	}
+	want := adaptive.Tally{Healthy: 15, Unhealthy: 5}
+	if got, full := tally.record(false, now); !full || got != want {
+		t.Fatalf("last response of the batch = %+v, %v, want %+v", got, full, want)
+	}
+
+	// A response after the interval adjusts the rate without a full batch
+	if _, full := tally.record(true, now.Add(adaptiveFlushInterval/2)); full {
+		t.Fatal("response within the interval adjusted the rate")
+	}
+	if got, full := tally.record(true, now.Add(adaptiveFlushInterval)); !full || got != (adaptive.Tally{Healthy: 2}) {
+		t.Fatalf("response after the interval = %+v, %v, want two healthy responses", got, full)
+	}
+}
@@ -0,0 +1,33 @@
+package limiters
+
+import (
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// Algorithm selects how requests are counted against a bucket
+type Algorithm = rate_limiter.Algorithm
+
+// Algorithms that can be set in the Algorithm field of the configs
+const (
+	// TokenBucket allows bursts up to Capacity and refills at RefillRate tokens per second
+	TokenBucket = rate_limiter.TokenBucket
+	// SlidingWindowLog allows at most Capacity requests in any rolling Window
+	SlidingWindowLog = rate_limiter.SlidingWindowLog
+	// SlidingWindowCounter approximates SlidingWindowLog with two counters per key
+	SlidingWindowCounter = rate_limiter.SlidingWindowCounter
+	// FixedWindow allows Capacity requests per window and resets on window boundaries
+	FixedWindow = rate_limiter.FixedWindow
+	// GCRA has the burst and rate of TokenBucket with one Redis value per key - distributed limiter only
+	GCRA = rate_limiter.GCRA
+)
+
+// WindowUnit is a calendar unit the FixedWindow windows can be aligned to
+type WindowUnit = rate_limiter.WindowUnit
+
+// Calendar units that can be set in the WindowUnit field of the configs
+const (
+	WindowMinute = rate_limiter.WindowMinute
+	WindowHour   = rate_limiter.WindowHour
+	WindowDay    = rate_limiter.WindowDay
+	WindowMonth  = rate_limiter.WindowMonth
+)
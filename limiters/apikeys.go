@@ -0,0 +1,289 @@
+package limiters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/helper"
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey is an API key issued to a partner along with its own limits
+type APIKey struct {
+	Key        string  // The API key sent by the partner
+	Capacity   int     // Capacity of the bucket of the key - the Capacity of the config when zero
+	RefillRate float64 // Refill rate of the bucket of the key - the RefillRate of the config when zero
+	DailyQuota int     // Requests allowed per calendar day in UTC - zero for no quota
+	Enabled    bool    // Disabled keys are rejected with 403
+}
+
+// apiKeyEntry is an API key as written in a JSON or YAML file
+// Keys are enabled unless the file says otherwise
+type apiKeyEntry struct {
+	Key        string  `json:"key" yaml:"key"`
+	Capacity   int     `json:"capacity" yaml:"capacity"`
+	RefillRate float64 `json:"refill_rate" yaml:"refill_rate"`
+	DailyQuota int     `json:"daily_quota" yaml:"daily_quota"`
+	Enabled    *bool   `json:"enabled" yaml:"enabled"`
+}
+
+// APIKeyStore holds the API keys loaded from a JSON, YAML or CSV file
+// The file is checked for changes every poll interval and reloaded when it changed.
+// With a store in the config, requests with an unknown key are rejected with 401 and requests with
+// a disabled key with 403, before their bucket is looked at
+type APIKeyStore struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    map[string]APIKey
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// LoadAPIKeyStore loads the API keys of a file and watches it for changes
+// The format follows the extension: .json and .yaml/.yml files hold a list of keys with the fields
+// key, capacity, refill_rate, daily_quota and enabled, .csv files have a header row with the same columns.
+// A zero poll interval disables the watching
+func LoadAPIKeyStore(path string, pollInterval time.Duration) (*APIKeyStore, error) {
+	store := &APIKeyStore{
+		path: path,
+		stop: make(chan struct{}),
+	}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	if pollInterval > 0 {
+		go store.watch(pollInterval)
+	}
+	return store, nil
+}
+
+// Lookup returns the API key if it is known
+func (s *APIKeyStore) Lookup(key string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	apiKey, ok := s.keys[key]
+	return apiKey, ok
+}
+
+// ResolveLimit gives every API key its own capacity and refill rate
+// The middlewares use the capacity and refill rate of the config for the zero values
+func (s *APIKeyStore) ResolveLimit(key string, r *http.Request) (Limit, error) {
+	apiKey, ok := s.Lookup(key)
+	if !ok {
+		return Limit{}, fmt.Errorf("unknown API key")
+	}
+	return Limit{Capacity: apiKey.Capacity, RefillRate: apiKey.RefillRate}, nil
+}
+
+// Reload reads the file again and swaps in its keys
+// The keys loaded before are kept if the file cannot be read
+func (s *APIKeyStore) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+
+	keys, err := parseAPIKeys(s.path, data)
+	if err != nil {
+		return fmt.Errorf("failed to parse API key file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Stop stops watching the file
+func (s *APIKeyStore) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// watch reloads the file whenever its modification time or size changes
+func (s *APIKeyStore) watch(pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(s.path)
+			if err != nil {
+				helper.Log("Failed to check API key file: "+err.Error(), "error")
+				continue
+			}
+
+			s.mu.RLock()
+			changed := !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+			s.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := s.Reload(); err != nil {
+				helper.Log(err.Error(), "error")
+				continue
+			}
+			helper.Log("API keys reloaded from "+s.path, "info")
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// parseAPIKeys parses the keys of a file in the format given by its extension
+func parseAPIKeys(path string, data []byte) (map[string]APIKey, error) {
+	var entries []apiKeyEntry
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		var err error
+		entries, err = parseAPIKeysCSV(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file extension %q - use .json, .yaml, .yml or .csv", filepath.Ext(path))
+	}
+
+	keys := make(map[string]APIKey, len(entries))
+	for i, entry := range entries {
+		if entry.Key == "" {
+			return nil, fmt.Errorf("key %d: key is empty", i+1)
+		}
+		if _, ok := keys[entry.Key]; ok {
+			return nil, fmt.Errorf("key %d: duplicate key", i+1)
+		}
+		if entry.Capacity < 0 || entry.RefillRate < 0 || entry.DailyQuota < 0 {
+			return nil, fmt.Errorf("key %d: capacity, refill_rate and daily_quota must not be negative", i+1)
+		}
+
+		keys[entry.Key] = APIKey{
+			Key:        entry.Key,
+			Capacity:   entry.Capacity,
+			RefillRate: entry.RefillRate,
+			DailyQuota: entry.DailyQuota,
+			Enabled:    entry.Enabled == nil || *entry.Enabled,
+		}
+	}
+	return keys, nil
+}
+
+// parseAPIKeysCSV parses a CSV file whose header row names the columns
+func parseAPIKeysCSV(data []byte) ([]apiKeyEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header row: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil, fmt.Errorf("missing key column")
+	}
+
+	var entries []apiKeyEntry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		entry := apiKeyEntry{Key: field("key")}
+		if value := field("capacity"); value != "" {
+			if entry.Capacity, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid capacity %q", line, value)
+			}
+		}
+		if value := field("refill_rate"); value != "" {
+			if entry.RefillRate, err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid refill_rate %q", line, value)
+			}
+		}
+		if value := field("daily_quota"); value != "" {
+			if entry.DailyQuota, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid daily_quota %q", line, value)
+			}
+		}
+		if value := field("enabled"); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid enabled %q", line, value)
+			}
+			entry.Enabled = &enabled
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// resolver resolves the limits of the API keys, filling in the capacity and refill rate of the config
+// for the keys without their own
+func (s *APIKeyStore) resolver(capacity int, refillRate float64) LimitResolver {
+	return LimitResolverFunc(func(key string, r *http.Request) (Limit, error) {
+		limit, err := s.ResolveLimit(key, r)
+		if err != nil {
+			return limit, err
+		}
+		if limit.Capacity == 0 {
+			limit.Capacity = capacity
+		}
+		if limit.RefillRate == 0 {
+			limit.RefillRate = refillRate
+		}
+		return limit, nil
+	})
+}
+
+// redactKey replaces an API key with the start of its SHA-256 hash, e.g. sha256:3f2a9c1b7d4e
+// It tells keys apart in the logs and rejections without revealing them
+func redactKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
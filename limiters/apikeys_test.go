@@ -0,0 +1,222 @@
+package limiters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	partner := APIKey{Key: "partner", Capacity: 100, RefillRate: 2.5, DailyQuota: 1000, Enabled: true}
+	disabled := APIKey{Key: "disabled"}
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    map[string]APIKey
+		wantErr string
+	}{
+		{
+			name:    "json",
+			path:    "keys.json",
+			content: `[{"key": "partner", "capacity": 100, "refill_rate": 2.5, "daily_quota": 1000}, {"key": "disabled", "enabled": false}]`,
+			want:    map[string]APIKey{"partner": partner, "disabled": disabled},
+		},
+		{
+			name:    "yaml",
+			path:    "keys.YML",
+			content: "- key: partner\n  capacity: 100\n  refill_rate: 2.5\n  daily_quota: 1000\n  enabled: true\n- key: disabled\n  enabled: false\n",
+			want:    map[string]APIKey{"partner": partner, "disabled": disabled},
+		},
+		{
+			name:    "csv with columns in any order",
+			path:    "keys.csv",
+			content: "enabled, Daily_Quota, key, refill_rate, capacity\n,1000,partner,2.5,100\nfalse,,disabled,,\n",
+			want:    map[string]APIKey{"partner": partner, "disabled": disabled},
+		},
+		{
+			name:    "csv with the key column only",
+			path:    "keys.csv",
+			content: "key\npartner\n",
+			want:    map[string]APIKey{"partner": {Key: "partner", Enabled: true}},
+		},
+		{name: "unknown extension", path: "keys.txt", content: "partner", wantErr: "unsupported file extension"},
+		{name: "invalid json", path: "keys.json", content: `{"key": "partner"}`, wantErr: "cannot unmarshal"},
+		{name: "empty key", path: "keys.json", content: `[{"key": "partner"}, {"capacity": 1}]`, wantErr: "key 2: key is empty"},
+		{name: "duplicate key", path: "keys.yaml", content: "- key: partner\n- key: partner\n", wantErr: "key 2: duplicate key"},
+		{name: "negative limit", path: "keys.json", content: `[{"key": "partner", "daily_quota": -1}]`, wantErr: "must not be negative"},
+		{name: "csv without a header", path: "keys.csv", content: "", wantErr: "missing header row"},
+		{name: "csv without a key column", path: "keys.csv", content: "name,capacity\npartner,1\n", wantErr: "missing key column"},
+		{name: "csv with an invalid number", path: "keys.csv", content: "key,capacity\npartner,ten\n", wantErr: `line 2: invalid capacity "ten"`},
+		{name: "csv with an invalid flag", path: "keys.csv", content: "key,enabled\npartner,maybe\n", wantErr: `line 2: invalid enabled "maybe"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAPIKeys(tt.path, []byte(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAPIKeys: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyStoreReload(t *testing.T) {
+	path := writeTestFile(t, "keys.csv", "key,capacity\nfirst,10\n")
+	store, err := LoadAPIKeyStore(path, 0)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	defer store.Stop()
+
+	if _, err := LoadAPIKeyStore(path+".missing", 0); err == nil {
+		t.Error("LoadAPIKeyStore of a missing file succeeded, want an error")
+	}
+
+	// A new file swaps in its keys
+	if err := os.WriteFile(path, []byte("key,capacity\nsecond,20\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, ok := store.Lookup("first"); ok {
+		t.Error("key of the previous file is still known")
+	}
+	if key, ok := store.Lookup("second"); !ok || key.Capacity != 20 {
+		t.Errorf("Lookup = %+v, %v, want the key of the new file", key, ok)
+	}
+
+	// An invalid file keeps the keys loaded before
+	if err := os.WriteFile(path, []byte("name\nthird\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded, want an error")
+	}
+	if _, ok := store.Lookup("second"); !ok {
+		t.Error("keys were dropped by a failed reload")
+	}
+}
+
+func TestAPIKeyStoreWatch(t *testing.T) {
+	path := writeTestFile(t, "keys.json", `[{"key": "first"}]`)
+	store, err := LoadAPIKeyStore(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	defer store.Stop()
+
+	// The size changes along with the content, so the change is seen even within the same modification time
+	if err := os.WriteFile(path, []byte(`[{"key": "first"}, {"key": "second"}]`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := store.Lookup("second"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("changed file was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAPIKeyStoreResolver(t *testing.T) {
+	store, err := LoadAPIKeyStore(writeTestFile(t, "keys.csv", "key,capacity,refill_rate\nown,50,5\ndefault,,\n"), 0)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	defer store.Stop()
+	resolver := store.resolver(10, 1)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	tests := []struct {
+		key     string
+		want    Limit
+		wantErr bool
+	}{
+		{key: "own", want: Limit{Capacity: 50, RefillRate: 5}},
+		{key: "default", want: Limit{Capacity: 10, RefillRate: 1}},
+		{key: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := resolver.ResolveLimit(tt.key, r)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("key %q: error = %v, want error %v", tt.key, err, tt.wantErr)
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("key %q: limit = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRedactKey(t *testing.T) {
+	redacted := redactKey("sk-live-secret")
+	if !strings.HasPrefix(redacted, "sha256:") || len(redacted) != len("sha256:")+12 {
+		t.Errorf("redactKey = %q, want sha256: and 12 hex digits", redacted)
+	}
+	if strings.Contains(redacted, "secret") {
+		t.Errorf("redactKey = %q reveals the key", redacted)
+	}
+	if redactKey("sk-live-secret") != redacted || redactKey("sk-live-other") == redacted {
+		t.Error("redactKey does not tell the keys apart consistently")
+	}
+}
+
+func TestDailyQuotaOrdering(t *testing.T) {
+	path := writeTestFile(t, "keys.csv", "key,capacity,daily_quota\npartner,2,1\n")
+	store, err := LoadAPIKeyStore(path, 0)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	defer store.Stop()
+
+	handler := newTestHandler(t, func(config *LocalRateLimiterConfig) {
+		config.RefillRate = 0.001
+		config.APIKeys = store
+	})
+	serve := func() (int, string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-ID", "partner")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	if code, _ := serve(); code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusOK)
+	}
+	if code, body := serve(); code != http.StatusTooManyRequests || !strings.Contains(body, "Daily quota exceeded") {
+		t.Fatalf("request past the quota: status = %d, body %q, want the daily quota rejection", code, body)
+	}
+
+	// The request rejected by the quota took no token from the bucket of the key - one is left for it
+	if err := os.WriteFile(path, []byte("key,capacity,daily_quota\npartner,2,10\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if code, _ := serve(); code != http.StatusOK {
+		t.Fatalf("request with the raised quota: status = %d, want %d", code, http.StatusOK)
+	}
+	if code, body := serve(); code != http.StatusTooManyRequests || strings.Contains(body, "Daily quota exceeded") {
+		t.Errorf("request past the capacity: status = %d, body %q, want the bucket rejection", code, body)
+	}
+}
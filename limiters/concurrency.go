@@ -0,0 +1,28 @@
+package limiters
+
+import (
+	"context"
+	"time"
+)
+
+// ConcurrencyConfig holds the in-flight request limits
+// A slot is taken once a request is allowed by the rate limiter and given back when the
+// handler - the reverse proxy in the proxy middlewares - returns
+type ConcurrencyConfig struct {
+	MaxInFlightPerKey int           // Maximum in-flight requests per key - zero for no limit
+	MaxInFlight       int           // Maximum in-flight requests across all the keys - zero for no limit
+	LeaseTime         time.Duration // Distributed only - slots of a crashed instance are freed after this long, at least 100ms
+}
+
+// minLeaseTime is the shortest lease of an in-flight slot
+// The lease is renewed every half lease, so a shorter one would mostly be spent renewing it
+const minLeaseTime = 100 * time.Millisecond
+
+// enabled reports if any in-flight limit is set
+func (c ConcurrencyConfig) enabled() bool {
+	return c.MaxInFlightPerKey > 0 || c.MaxInFlight > 0
+}
+
+// acquireFunc takes an in-flight slot for a request group
+// It returns the function giving the slot back, or false if no slot is free
+type acquireFunc func(ctx context.Context, id string, perKey, global int) (func(), bool, error)
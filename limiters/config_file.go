@@ -0,0 +1,857 @@
+package limiters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Backends that can be set in the backend field of a config file
+const (
+	LocalBackend       = "local"
+	DistributedBackend = "distributed"
+)
+
+// Duration is a time.Duration written as a string in config files, e.g. "1m30s"
+type Duration time.Duration
+
+// UnmarshalText parses durations like "500ms" or "1h"
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", string(text))
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalText writes the duration the way it is parsed
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// FileConfig is the content of a config file
+// Fields left out of the file keep the values of the default config of the backend.
+// String values can come from the environment with ${NAME} or ${NAME:-default}, e.g. for the Redis password
+type FileConfig struct {
+	Backend         string                `json:"backend" yaml:"backend" toml:"backend"`                            // local (default) or distributed
+	TargetURL       string                `json:"target_url" yaml:"target_url" toml:"target_url"`                   // Target URL for reverse proxy
+	Capacity        *int                  `json:"capacity" yaml:"capacity" toml:"capacity"`                         // Capacity of each bucket
+	RefillRate      *float64              `json:"refill_rate" yaml:"refill_rate" toml:"refill_rate"`                // Refill rate of each bucket in tokens per second
+	Algorithm       string                `json:"algorithm" yaml:"algorithm" toml:"algorithm"`                      // Rate limiting algorithm, e.g. token-bucket or fixed-window
+	Window          *Duration             `json:"window" yaml:"window" toml:"window"`                               // Window of the window based algorithms
+	WindowUnit      string                `json:"window_unit" yaml:"window_unit" toml:"window_unit"`                // Calendar unit of the fixed-window windows
+	Location        string                `json:"location" yaml:"location" toml:"location"`                         // Time zone of the calendar windows, e.g. Europe/Berlin
+	MaxEntries      *int                  `json:"max_entries" yaml:"max_entries" toml:"max_entries"`                // Local only - maximum number of buckets in memory
+	CleanupInterval *Duration             `json:"cleanup_interval" yaml:"cleanup_interval" toml:"cleanup_interval"` // Interval of the cleanup of the expired buckets
+	ExpirationTime  *Duration             `json:"expiration_time" yaml:"expiration_time" toml:"expiration_time"`    // Idle time after which a bucket expires
+	Redis           RedisFileConfig       `json:"redis" yaml:"redis" toml:"redis"`                                  // Distributed only - Redis connection
+	Key             KeyFileConfig         `json:"key" yaml:"key" toml:"key"`                                        // Key extraction
+	Cost            int                   `json:"cost" yaml:"cost" toml:"cost"`                                     // Tokens every request costs - one when zero
+	Queue           QueueFileConfig       `json:"queue" yaml:"queue" toml:"queue"`                                  // Queueing mode
+	Concurrency     ConcurrencyFileConfig `json:"concurrency" yaml:"concurrency" toml:"concurrency"`                // In-flight request limits
+	Adaptive        AdaptiveFileConfig    `json:"adaptive" yaml:"adaptive" toml:"adaptive"`                         // Adaptive mode
+	Global          GlobalFileConfig      `json:"global" yaml:"global" toml:"global"`                               // Bucket shared by all the requests
+	Hierarchy       *HierarchyFileConfig  `json:"hierarchy" yaml:"hierarchy" toml:"hierarchy"`                      // Parent level above every key
+	APIKeys         *APIKeysFileConfig    `json:"api_keys" yaml:"api_keys" toml:"api_keys"`                         // API key file
+	Rules           []RuleFileConfig      `json:"rules" yaml:"rules" toml:"rules"`                                  // Limits every key is held to at once
+	Routes          []RouteFileConfig     `json:"routes" yaml:"routes" toml:"routes"`                               // Routes with their own limits
+	Headers         HeadersFileConfig     `json:"headers" yaml:"headers" toml:"headers"`                            // Rate limit headers of the responses
+	Rejection       RejectionFileConfig   `json:"rejection" yaml:"rejection" toml:"rejection"`                      // Responses of the rejected requests
+	Namespace       string                `json:"namespace" yaml:"namespace" toml:"namespace"`                      // Prefix of the buckets of the middleware
+}
+
+// RedisFileConfig is the Redis connection of the distributed backend
+type RedisFileConfig struct {
+	Address   string `json:"address" yaml:"address" toml:"address"`          // Redis address, e.g. localhost:6379
+	Password  string `json:"password" yaml:"password" toml:"password"`       // Redis password - use ${REDIS_PASSWORD} to keep it out of the file
+	DB        int    `json:"db" yaml:"db" toml:"db"`                         // Redis DB number
+	KeyPrefix string `json:"key_prefix" yaml:"key_prefix" toml:"key_prefix"` // Redis key prefix
+}
+
+// KeyFileConfig describes how the key of a request is extracted
+// Several sources together make a composite key, joined in the order of the fields
+type KeyFileConfig struct {
+	ClientIP       bool     `json:"client_ip" yaml:"client_ip" toml:"client_ip"`                   // Key by the client IP
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies" toml:"trusted_proxies"` // Proxies whose forwarding headers are trusted for client_ip
+	Header         string   `json:"header" yaml:"header" toml:"header"`                            // Key by a header
+	Query          string   `json:"query" yaml:"query" toml:"query"`                               // Key by a query parameter
+	Cookie         string   `json:"cookie" yaml:"cookie" toml:"cookie"`                            // Key by a cookie
+	PathSegment    *int     `json:"path_segment" yaml:"path_segment" toml:"path_segment"`          // Key by a segment of the path, counted from zero
+	Method         bool     `json:"method" yaml:"method" toml:"method"`                            // Key by the HTTP method
+	Default        string   `json:"default" yaml:"default" toml:"default"`                         // Key of the requests without one
+}
+
+// QueueFileConfig is the queueing mode
+type QueueFileConfig struct {
+	Enabled       bool      `json:"enabled" yaml:"enabled" toml:"enabled"`
+	MaxQueueDepth *int      `json:"max_queue_depth" yaml:"max_queue_depth" toml:"max_queue_depth"`
+	MaxWait       *Duration `json:"max_wait" yaml:"max_wait" toml:"max_wait"`
+}
+
+// ConcurrencyFileConfig is the in-flight request limits
+type ConcurrencyFileConfig struct {
+	MaxInFlightPerKey int       `json:"max_in_flight_per_key" yaml:"max_in_flight_per_key" toml:"max_in_flight_per_key"`
+	MaxInFlight       int       `json:"max_in_flight" yaml:"max_in_flight" toml:"max_in_flight"`
+	LeaseTime         *Duration `json:"lease_time" yaml:"lease_time" toml:"lease_time"`
+}
+
+// AdaptiveFileConfig is the adaptive mode
+type AdaptiveFileConfig struct {
+	Enabled          bool      `json:"enabled" yaml:"enabled" toml:"enabled"`
+	MinRefillRate    *float64  `json:"min_refill_rate" yaml:"min_refill_rate" toml:"min_refill_rate"`
+	DecreaseFactor   *float64  `json:"decrease_factor" yaml:"decrease_factor" toml:"decrease_factor"`
+	IncreaseStep     *float64  `json:"increase_step" yaml:"increase_step" toml:"increase_step"`
+	LatencyThreshold *Duration `json:"latency_threshold" yaml:"latency_threshold" toml:"latency_threshold"`
+}
+
+// GlobalFileConfig is the bucket shared by all the requests
+type GlobalFileConfig struct {
+	Enabled    bool    `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Capacity   int     `json:"capacity" yaml:"capacity" toml:"capacity"`
+	RefillRate float64 `json:"refill_rate" yaml:"refill_rate" toml:"refill_rate"`
+}
+
+// HeadersFileConfig is the rate limit headers of the responses
+type HeadersFileConfig struct {
+	Disabled bool `json:"disabled" yaml:"disabled" toml:"disabled"` // Send no RateLimit-* headers
+	Legacy   bool `json:"legacy" yaml:"legacy" toml:"legacy"`       // Also send the X-RateLimit-* headers
+}
+
+// RejectionFileConfig is the responses of the rejected requests
+type RejectionFileConfig struct {
+	Format       string `json:"format" yaml:"format" toml:"format"`                      // text (default), json or problem for RFC 9457 problem details
+	DocsURL      string `json:"docs_url" yaml:"docs_url" toml:"docs_url"`                // Documentation of the errors - the type of the problem details
+	Status       int    `json:"status" yaml:"status" toml:"status"`                      // Status code of the rate limited requests - 429 when zero
+	GlobalStatus int    `json:"global_status" yaml:"global_status" toml:"global_status"` // Status code when the global bucket rejects the request
+}
+
+// HierarchyFileConfig is the parent level above every key
+type HierarchyFileConfig struct {
+	ParentKey KeyFileConfig  `json:"parent_key" yaml:"parent_key" toml:"parent_key"`
+	Parent    RuleFileConfig `json:"parent" yaml:"parent" toml:"parent"`
+}
+
+// APIKeysFileConfig is the file of the known API keys
+type APIKeysFileConfig struct {
+	File         string    `json:"file" yaml:"file" toml:"file"`                            // JSON, YAML or CSV file of the keys
+	PollInterval *Duration `json:"poll_interval" yaml:"poll_interval" toml:"poll_interval"` // How often the file is checked for changes - 10s by default
+}
+
+// RuleFileConfig is a limit rule
+type RuleFileConfig struct {
+	Name       string    `json:"name" yaml:"name" toml:"name"`
+	Capacity   int       `json:"capacity" yaml:"capacity" toml:"capacity"`
+	RefillRate float64   `json:"refill_rate" yaml:"refill_rate" toml:"refill_rate"`
+	Algorithm  string    `json:"algorithm" yaml:"algorithm" toml:"algorithm"`
+	Window     *Duration `json:"window" yaml:"window" toml:"window"`
+	WindowUnit string    `json:"window_unit" yaml:"window_unit" toml:"window_unit"`
+	Location   string    `json:"location" yaml:"location" toml:"location"`
+}
+
+// RouteFileConfig is a route with its own limits
+type RouteFileConfig struct {
+	Name       string         `json:"name" yaml:"name" toml:"name"`
+	Path       string         `json:"path" yaml:"path" toml:"path"`
+	PathMatch  string         `json:"path_match" yaml:"path_match" toml:"path_match"`
+	Methods    []string       `json:"methods" yaml:"methods" toml:"methods"`
+	Host       string         `json:"host" yaml:"host" toml:"host"`
+	Unlimited  bool           `json:"unlimited" yaml:"unlimited" toml:"unlimited"`
+	Capacity   int            `json:"capacity" yaml:"capacity" toml:"capacity"`
+	RefillRate float64        `json:"refill_rate" yaml:"refill_rate" toml:"refill_rate"`
+	Algorithm  string         `json:"algorithm" yaml:"algorithm" toml:"algorithm"`
+	Window     *Duration      `json:"window" yaml:"window" toml:"window"`
+	WindowUnit string         `json:"window_unit" yaml:"window_unit" toml:"window_unit"`
+	Location   string         `json:"location" yaml:"location" toml:"location"`
+	Key        *KeyFileConfig `json:"key" yaml:"key" toml:"key"`
+	Cost       int            `json:"cost" yaml:"cost" toml:"cost"`
+}
+
+// LoadConfigFile reads a YAML, JSON or TOML config file, picked by the extension, and validates it
+// Every problem found is reported with the field it is in
+func LoadConfigFile(path string) (FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, err := ParseConfigFile(data, filepath.Ext(path))
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfigFile parses and validates the content of a config file in the format of the extension -
+// .yaml, .yml, .json or .toml
+func ParseConfigFile(data []byte, extension string) (FileConfig, error) {
+	// Unknown fields are rejected, so a typo does not silently leave a default in place
+	var config FileConfig
+	switch strings.ToLower(strings.TrimPrefix(extension, ".")) {
+	case "yaml", "yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil {
+			return FileConfig{}, err
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return FileConfig{}, err
+		}
+	case "toml":
+		metadata, err := toml.Decode(string(data), &config)
+		if err != nil {
+			return FileConfig{}, err
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return FileConfig{}, fmt.Errorf("unknown field %q", undecoded[0].String())
+		}
+	default:
+		return FileConfig{}, fmt.Errorf("unsupported config file extension %q - use .yaml, .yml, .json or .toml", extension)
+	}
+
+	if err := interpolateEnv(&config); err != nil {
+		return FileConfig{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return FileConfig{}, err
+	}
+	return config, nil
+}
+
+// envPattern matches ${NAME} and ${NAME:-default}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv replaces the environment variables in the string fields of the decoded config
+// The file is parsed first, so a value needs no escaping - quotes, backslashes or a # in a password are
+// kept as they are - and variables in comments are ignored. A variable that is not set and has no default is an error
+func interpolateEnv(config *FileConfig) error {
+	var missing []string
+	expandStrings(reflect.ValueOf(config).Elem(), func(value string) string {
+		return envPattern.ReplaceAllStringFunc(value, func(match string) string {
+			groups := envPattern.FindStringSubmatch(match)
+			if value, ok := os.LookupEnv(groups[1]); ok {
+				return value
+			}
+			if groups[2] != "" {
+				return groups[3]
+			}
+			missing = append(missing, groups[1])
+			return match
+		})
+	})
+
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expandStrings runs expand on every string in the value, following pointers, structs and slices
+func expandStrings(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(expand(v.String()))
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandStrings(v.Elem(), expand)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandStrings(v.Field(i), expand)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandStrings(v.Index(i), expand)
+		}
+	}
+}
+
+// configErrors collects the problems of a config file
+type configErrors []string
+
+func (errs *configErrors) add(field, format string, args ...interface{}) {
+	*errs = append(*errs, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (errs configErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n  - %s", strings.Join(errs, "\n  - "))
+}
+
+// Validate checks every field of the config and reports all the problems at once
+func (c FileConfig) Validate() error {
+	var errs configErrors
+
+	switch c.Backend {
+	case "", LocalBackend, DistributedBackend:
+	default:
+		errs.add("backend", "must be %q or %q, got %q", LocalBackend, DistributedBackend, c.Backend)
+	}
+
+	if c.TargetURL == "" {
+		errs.add("target_url", "is required")
+	} else if target, err := url.Parse(c.TargetURL); err != nil || target.Scheme == "" || target.Host == "" {
+		errs.add("target_url", "must be an absolute URL like http://localhost:8080, got %q", c.TargetURL)
+	}
+
+	if c.Capacity != nil && *c.Capacity <= 0 {
+		errs.add("capacity", "must be greater than zero, got %d", *c.Capacity)
+	}
+	if c.RefillRate != nil {
+		validateRefillRate(&errs, "", c.Algorithm, *c.RefillRate)
+	}
+	validateAlgorithm(&errs, "", c.Algorithm, c.Window, c.WindowUnit, c.Location)
+	if c.Backend != DistributedBackend && Algorithm(c.Algorithm) == GCRA {
+		errs.add("algorithm", "%q is only supported by the distributed backend", GCRA)
+	}
+
+	if c.MaxEntries != nil && *c.MaxEntries <= 0 {
+		errs.add("max_entries", "must be greater than zero, got %d", *c.MaxEntries)
+	}
+	validatePositiveDuration(&errs, "cleanup_interval", c.CleanupInterval)
+	validatePositiveDuration(&errs, "expiration_time", c.ExpirationTime)
+
+	if c.Backend == DistributedBackend {
+		if c.Redis.Address == "" {
+			errs.add("redis.address", "is required for the distributed backend")
+		}
+		if c.Redis.DB < 0 {
+			errs.add("redis.db", "must not be negative, got %d", c.Redis.DB)
+		}
+	}
+
+	validateKey(&errs, "key", c.Key, true)
+	if c.Cost < 0 {
+		errs.add("cost", "must not be negative, got %d", c.Cost)
+	}
+
+	if c.Queue.MaxQueueDepth != nil && *c.Queue.MaxQueueDepth <= 0 {
+		errs.add("queue.max_queue_depth", "must be greater than zero, got %d", *c.Queue.MaxQueueDepth)
+	}
+	validatePositiveDuration(&errs, "queue.max_wait", c.Queue.MaxWait)
+
+	if c.Concurrency.MaxInFlightPerKey < 0 {
+		errs.add("concurrency.max_in_flight_per_key", "must not be negative, got %d", c.Concurrency.MaxInFlightPerKey)
+	}
+	if c.Concurrency.MaxInFlight < 0 {
+		errs.add("concurrency.max_in_flight", "must not be negative, got %d", c.Concurrency.MaxInFlight)
+	}
+	if c.Concurrency.LeaseTime != nil && time.Duration(*c.Concurrency.LeaseTime) < minLeaseTime {
+		errs.add("concurrency.lease_time", "must be at least %s, got %s", minLeaseTime, time.Duration(*c.Concurrency.LeaseTime))
+	}
+
+	if c.Adaptive.MinRefillRate != nil && *c.Adaptive.MinRefillRate <= 0 {
+		errs.add("adaptive.min_refill_rate", "must be greater than zero, got %v", *c.Adaptive.MinRefillRate)
+	}
+	if c.Adaptive.DecreaseFactor != nil && (*c.Adaptive.DecreaseFactor <= 0 || *c.Adaptive.DecreaseFactor >= 1) {
+		errs.add("adaptive.decrease_factor", "must be between 0 and 1, got %v", *c.Adaptive.DecreaseFactor)
+	}
+	if c.Adaptive.IncreaseStep != nil && *c.Adaptive.IncreaseStep <= 0 {
+		errs.add("adaptive.increase_step", "must be greater than zero, got %v", *c.Adaptive.IncreaseStep)
+	}
+
+	if c.Global.Enabled {
+		if c.Global.Capacity <= 0 {
+			errs.add("global.capacity", "must be greater than zero, got %d", c.Global.Capacity)
+		}
+		if c.Global.RefillRate <= 0 {
+			errs.add("global.refill_rate", "must be greater than zero, got %v", c.Global.RefillRate)
+		}
+	}
+
+	switch c.Rejection.Format {
+	case "", "text", "json", "problem":
+	default:
+		errs.add("rejection.format", "must be text, json or problem, got %q", c.Rejection.Format)
+	}
+	if c.Rejection.Status != 0 && (c.Rejection.Status < 400 || c.Rejection.Status > 599) {
+		errs.add("rejection.status", "must be between 400 and 599, got %d", c.Rejection.Status)
+	}
+	if c.Rejection.GlobalStatus != 0 && (c.Rejection.GlobalStatus < 400 || c.Rejection.GlobalStatus > 599) {
+		errs.add("rejection.global_status", "must be between 400 and 599, got %d", c.Rejection.GlobalStatus)
+	}
+
+	if c.Hierarchy != nil {
+		validateKey(&errs, "hierarchy.parent_key", c.Hierarchy.ParentKey, true)
+		validateRule(&errs, "hierarchy.parent", c.Hierarchy.Parent)
+	}
+
+	if c.APIKeys != nil {
+		if c.APIKeys.File == "" {
+			errs.add("api_keys.file", "is required")
+		}
+		validatePositiveDuration(&errs, "api_keys.poll_interval", c.APIKeys.PollInterval)
+	}
+
+	names := make(map[string]bool, len(c.Rules))
+	for i, rule := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		validateRule(&errs, field, rule)
+		if names[rule.Name] {
+			errs.add(field+".name", "duplicate name %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	names = make(map[string]bool, len(c.Routes))
+	for i, route := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		if route.Name == "" {
+			errs.add(field+".name", "is required")
+		} else if names[route.Name] {
+			errs.add(field+".name", "duplicate name %q", route.Name)
+		}
+		names[route.Name] = true
+
+		switch PathMatch(route.PathMatch) {
+		case "", PathPrefix, PathGlob:
+		case PathRegex:
+			if _, err := regexp.Compile(route.Path); err != nil {
+				errs.add(field+".path", "invalid regular expression: %v", err)
+			}
+		default:
+			errs.add(field+".path_match", "must be %q, %q or %q, got %q", PathPrefix, PathGlob, PathRegex, route.PathMatch)
+		}
+
+		if route.Key != nil {
+			validateKey(&errs, field+".key", *route.Key, false)
+		}
+		if route.Cost < 0 {
+			errs.add(field+".cost", "must not be negative, got %d", route.Cost)
+		}
+		if route.Unlimited {
+			continue
+		}
+		if route.Capacity <= 0 {
+			errs.add(field+".capacity", "must be greater than zero, got %d", route.Capacity)
+		}
+		validateAlgorithm(&errs, field+".", route.Algorithm, route.Window, route.WindowUnit, route.Location)
+		validateRefillRate(&errs, field, route.Algorithm, route.RefillRate)
+	}
+
+	return errs.err()
+}
+
+// validatePositiveDuration checks that a duration set in the file is greater than zero
+func validatePositiveDuration(errs *configErrors, field string, d *Duration) {
+	if d != nil && *d <= 0 {
+		errs.add(field, "must be greater than zero, got %s", time.Duration(*d))
+	}
+}
+
+// validateAlgorithm checks the algorithm settings of the config, a rule or a route
+func validateAlgorithm(errs *configErrors, prefix, algorithm string, window *Duration, windowUnit, location string) {
+	switch Algorithm(algorithm) {
+	case "", TokenBucket, GCRA, SlidingWindowLog, SlidingWindowCounter, FixedWindow:
+	default:
+		errs.add(prefix+"algorithm", "must be one of %s, %s, %s, %s or %s, got %q",
+			TokenBucket, GCRA, SlidingWindowLog, SlidingWindowCounter, FixedWindow, algorithm)
+	}
+	validatePositiveDuration(errs, prefix+"window", window)
+
+	switch WindowUnit(windowUnit) {
+	case "", WindowMinute, WindowHour, WindowDay, WindowMonth:
+	default:
+		errs.add(prefix+"window_unit", "must be one of %s, %s, %s or %s, got %q",
+			WindowMinute, WindowHour, WindowDay, WindowMonth, windowUnit)
+	}
+
+	if location != "" {
+		if _, err := time.LoadLocation(location); err != nil {
+			errs.add(prefix+"location", "unknown time zone %q", location)
+		}
+	}
+}
+
+// validateRefillRate checks that the token bucket and GCRA get a refill rate
+// The prefix is the path of the rule or route, empty for the top level
+func validateRefillRate(errs *configErrors, prefix, algorithm string, refillRate float64) {
+	field := "refill_rate"
+	if prefix != "" {
+		field = prefix + ".refill_rate"
+	}
+
+	switch Algorithm(algorithm) {
+	case "", TokenBucket, GCRA:
+		if refillRate <= 0 {
+			errs.add(field, "must be greater than zero, got %v", refillRate)
+		}
+	default:
+		if refillRate < 0 {
+			errs.add(field, "must not be negative, got %v", refillRate)
+		}
+	}
+}
+
+// validateRule checks a limit rule
+func validateRule(errs *configErrors, field string, rule RuleFileConfig) {
+	if rule.Name == "" {
+		errs.add(field+".name", "is required")
+	}
+	if rule.Capacity <= 0 {
+		errs.add(field+".capacity", "must be greater than zero, got %d", rule.Capacity)
+	}
+	validateAlgorithm(errs, field+".", rule.Algorithm, rule.Window, rule.WindowUnit, rule.Location)
+	validateRefillRate(errs, field, rule.Algorithm, rule.RefillRate)
+}
+
+// validateKey checks the key extraction - required tells if at least one source has to be set
+func validateKey(errs *configErrors, field string, key KeyFileConfig, required bool) {
+	if key.PathSegment != nil && *key.PathSegment < 0 {
+		errs.add(field+".path_segment", "must not be negative, got %d", *key.PathSegment)
+	}
+	if key.ClientIP {
+		if _, err := ClientIPKey(key.TrustedProxies...); err != nil {
+			errs.add(field+".trusted_proxies", "%v", err)
+		}
+	} else if len(key.TrustedProxies) > 0 {
+		errs.add(field+".trusted_proxies", "requires client_ip")
+	}
+	if required && !key.set() {
+		errs.add(field, "set at least one of client_ip, header, query, cookie, path_segment or method")
+	}
+}
+
+// set reports if the key has at least one source
+func (key KeyFileConfig) set() bool {
+	return key.ClientIP || key.Header != "" || key.Query != "" || key.Cookie != "" || key.PathSegment != nil || key.Method
+}
+
+// keyFunc builds the key extractor - a composite key when several sources are set
+func (key KeyFileConfig) keyFunc() (KeyFunc, error) {
+	var parts []KeyFunc
+	if key.ClientIP {
+		clientIP, err := ClientIPKey(key.TrustedProxies...)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, clientIP)
+	}
+	if key.Header != "" {
+		parts = append(parts, HeaderKey(key.Header))
+	}
+	if key.Query != "" {
+		parts = append(parts, QueryKey(key.Query))
+	}
+	if key.Cookie != "" {
+		parts = append(parts, CookieKey(key.Cookie))
+	}
+	if key.PathSegment != nil {
+		parts = append(parts, PathSegmentKey(*key.PathSegment))
+	}
+	if key.Method {
+		parts = append(parts, MethodKey())
+	}
+
+	switch len(parts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return parts[0], nil
+	default:
+		return CompositeKey(parts...), nil
+	}
+}
+
+// onlyHeader reports if the key is a single header - set as UniqueHeaderNameInRequest then
+func (key KeyFileConfig) onlyHeader() bool {
+	return key.Header != "" && !key.ClientIP && key.Query == "" && key.Cookie == "" && key.PathSegment == nil && !key.Method
+}
+
+// loadLocation loads a time zone, nil for UTC
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	location, _ := time.LoadLocation(name)
+	return location
+}
+
+// durationOr returns the duration set in the file, else the default
+func durationOr(d *Duration, defaultValue time.Duration) time.Duration {
+	if d == nil {
+		return defaultValue
+	}
+	return time.Duration(*d)
+}
+
+// rule converts a rule of the file
+func (rule RuleFileConfig) rule() Rule {
+	return Rule{
+		Name:       rule.Name,
+		Capacity:   rule.Capacity,
+		RefillRate: rule.RefillRate,
+		Algorithm:  Algorithm(rule.Algorithm),
+		Window:     durationOr(rule.Window, 0),
+		WindowUnit: WindowUnit(rule.WindowUnit),
+		Location:   loadLocation(rule.Location),
+	}
+}
+
+// limiterSettings holds the fields both backends share, converted from the file
+type limiterSettings struct {
+	headerName string
+	keyFunc    KeyFunc
+	cost       CostFunc
+	rules      []Rule
+	routes     []Route
+	hierarchy  HierarchyConfig
+	apiKeys    *APIKeyStore
+}
+
+// shared converts the fields both backends share
+// It loads the API key file when one is set
+func (c FileConfig) shared() (limiterSettings, error) {
+	var settings limiterSettings
+
+	if c.Key.onlyHeader() {
+		settings.headerName = c.Key.Header
+	} else {
+		keyFunc, err := c.Key.keyFunc()
+		if err != nil {
+			return settings, fmt.Errorf("key: %w", err)
+		}
+		settings.keyFunc = keyFunc
+	}
+
+	if c.Cost > 0 {
+		settings.cost = FixedCost(c.Cost)
+	}
+
+	for _, rule := range c.Rules {
+		settings.rules = append(settings.rules, rule.rule())
+	}
+
+	for _, route := range c.Routes {
+		converted := Route{
+			Name:       route.Name,
+			Path:       route.Path,
+			PathMatch:  PathMatch(route.PathMatch),
+			Methods:    route.Methods,
+			Host:       route.Host,
+			Unlimited:  route.Unlimited,
+			Capacity:   route.Capacity,
+			RefillRate: route.RefillRate,
+			Algorithm:  Algorithm(route.Algorithm),
+			Window:     durationOr(route.Window, 0),
+			WindowUnit: WindowUnit(route.WindowUnit),
+			Location:   loadLocation(route.Location),
+		}
+		if route.Key != nil {
+			keyFunc, err := route.Key.keyFunc()
+			if err != nil {
+				return settings, fmt.Errorf("routes %q key: %w", route.Name, err)
+			}
+			converted.KeyFunc = keyFunc
+		}
+		if route.Cost > 0 {
+			converted.Cost = FixedCost(route.Cost)
+		}
+		settings.routes = append(settings.routes, converted)
+	}
+
+	if c.Hierarchy != nil {
+		parentKey, err := c.Hierarchy.ParentKey.keyFunc()
+		if err != nil {
+			return settings, fmt.Errorf("hierarchy.parent_key: %w", err)
+		}
+		settings.hierarchy = HierarchyConfig{
+			ParentKeyFunc: parentKey,
+			Parent:        c.Hierarchy.Parent.rule(),
+		}
+	}
+
+	if c.APIKeys != nil {
+		store, err := LoadAPIKeyStore(c.APIKeys.File, durationOr(c.APIKeys.PollInterval, 10*time.Second))
+		if err != nil {
+			return settings, fmt.Errorf("api_keys: %w", err)
+		}
+		settings.apiKeys = store
+	}
+
+	return settings, nil
+}
+
+// applyQueue overrides the queueing mode of a config with the fields set in the file
+func (c FileConfig) applyQueue(queue QueueConfig) QueueConfig {
+	queue.Enabled = c.Queue.Enabled
+	if c.Queue.MaxQueueDepth != nil {
+		queue.MaxQueueDepth = *c.Queue.MaxQueueDepth
+	}
+	queue.MaxWait = durationOr(c.Queue.MaxWait, queue.MaxWait)
+	return queue
+}
+
+// applyAdaptive overrides the adaptive mode of a config with the fields set in the file
+func (c FileConfig) applyAdaptive(adaptive AdaptiveConfig) AdaptiveConfig {
+	adaptive.Enabled = c.Adaptive.Enabled
+	if c.Adaptive.MinRefillRate != nil {
+		adaptive.MinRefillRate = *c.Adaptive.MinRefillRate
+	}
+	if c.Adaptive.DecreaseFactor != nil {
+		adaptive.DecreaseFactor = *c.Adaptive.DecreaseFactor
+	}
+	if c.Adaptive.IncreaseStep != nil {
+		adaptive.IncreaseStep = *c.Adaptive.IncreaseStep
+	}
+	adaptive.LatencyThreshold = durationOr(c.Adaptive.LatencyThreshold, adaptive.LatencyThreshold)
+	return adaptive
+}
+
+// rejection returns the rejection responses of the file
+func (c FileConfig) rejection() RejectionConfig {
+	rejection := RejectionConfig{
+		Status:       c.Rejection.Status,
+		GlobalStatus: c.Rejection.GlobalStatus,
+	}
+	switch c.Rejection.Format {
+	case "json":
+		rejection.Handler = JSONRejection(nil)
+	case "problem":
+		rejection.Handler = ProblemDetailsRejection(c.Rejection.DocsURL)
+	}
+	return rejection
+}
+
+// LocalConfig converts the file into the config of the local rate limiter
+// Fields left out of the file keep the values of GetLocalRateLimiterDefaultConfig
+func (c FileConfig) LocalConfig() (LocalRateLimiterConfig, error) {
+	if c.Backend == DistributedBackend {
+		return LocalRateLimiterConfig{}, fmt.Errorf("backend: config file is for the %s backend", c.Backend)
+	}
+
+	settings, err := c.shared()
+	if err != nil {
+		return LocalRateLimiterConfig{}, err
+	}
+
+	config := GetLocalRateLimiterDefaultConfig()
+	config.TargetURL = c.TargetURL
+	if c.Capacity != nil {
+		config.Capacity = *c.Capacity
+	}
+	if c.RefillRate != nil {
+		config.RefillRate = *c.RefillRate
+	}
+	if c.Algorithm != "" {
+		config.Algorithm = Algorithm(c.Algorithm)
+	}
+	config.Window = durationOr(c.Window, config.Window)
+	config.WindowUnit = WindowUnit(c.WindowUnit)
+	config.Location = loadLocation(c.Location)
+	if c.MaxEntries != nil {
+		config.MaxEntries = *c.MaxEntries
+	}
+	config.CleanupInterval = durationOr(c.CleanupInterval, config.CleanupInterval)
+	config.ExpirationTime = durationOr(c.ExpirationTime, config.ExpirationTime)
+
+	config.UniqueHeaderNameInRequest = settings.headerName
+	config.KeyFunc = settings.keyFunc
+	config.DefaultKey = c.Key.Default
+	config.Cost = settings.cost
+	config.Queue = c.applyQueue(config.Queue)
+	config.Concurrency = ConcurrencyConfig{
+		MaxInFlightPerKey: c.Concurrency.MaxInFlightPerKey,
+		MaxInFlight:       c.Concurrency.MaxInFlight,
+	}
+	config.Adaptive = c.applyAdaptive(config.Adaptive)
+	config.Global = GlobalConfig(c.Global)
+	config.Hierarchy = settings.hierarchy
+	config.APIKeys = settings.apiKeys
+	config.Rules = settings.rules
+	config.Routes = settings.routes
+	config.Headers = HeadersConfig(c.Headers)
+	config.Rejection = c.rejection()
+	config.Namespace = c.Namespace
+
+	// The combinations of the settings are checked the same way the middlewares check them
+	if _, err := config.middlewareSettings(); err != nil {
+		if config.APIKeys != nil {
+			config.APIKeys.Stop()
+		}
+		return LocalRateLimiterConfig{}, err
+	}
+	return config, nil
+}
+
+// DistributedConfig converts the file into the config of the distributed rate limiter
+// Fields left out of the file keep the values of GetDistributedRateLimiterDefaultConfig
+func (c FileConfig) DistributedConfig() (DistributedRateLimiterConfig, error) {
+	if c.Backend != DistributedBackend {
+		return DistributedRateLimiterConfig{}, fmt.Errorf("backend: config file is for the %s backend", LocalBackend)
+	}
+
+	settings, err := c.shared()
+	if err != nil {
+		return DistributedRateLimiterConfig{}, err
+	}
+
+	config := GetDistributedRateLimiterDefaultConfig()
+	config.TargetURL = c.TargetURL
+	if c.Capacity != nil {
+		config.Capacity = *c.Capacity
+	}
+	if c.RefillRate != nil {
+		config.RefillRate = *c.RefillRate
+	}
+	if c.Algorithm != "" {
+		config.Algorithm = Algorithm(c.Algorithm)
+	}
+	config.Window = durationOr(c.Window, config.Window)
+	config.WindowUnit = WindowUnit(c.WindowUnit)
+	config.Location = loadLocation(c.Location)
+	config.CleanupInterval = durationOr(c.CleanupInterval, config.CleanupInterval)
+	config.ExpirationTime = durationOr(c.ExpirationTime, config.ExpirationTime)
+
+	config.RedisDBAddress = c.Redis.Address
+	config.RedisDBPassword = c.Redis.Password
+	config.StorageDB = c.Redis.DB
+	if c.Redis.KeyPrefix != "" {
+		config.KeyPrefix = c.Redis.KeyPrefix
+	}
+
+	config.UniqueHeaderNameInRequest = settings.headerName
+	config.KeyFunc = settings.keyFunc
+	config.DefaultKey = c.Key.Default
+	config.Cost = settings.cost
+	config.Queue = c.applyQueue(config.Queue)
+	config.Concurrency = ConcurrencyConfig{
+		MaxInFlightPerKey: c.Concurrency.MaxInFlightPerKey,
+		MaxInFlight:       c.Concurrency.MaxInFlight,
+		LeaseTime:         durationOr(c.Concurrency.LeaseTime, config.Concurrency.LeaseTime),
+	}
+	config.Adaptive = c.applyAdaptive(config.Adaptive)
+	config.Global = GlobalConfig(c.Global)
+	config.Hierarchy = settings.hierarchy
+	config.APIKeys = settings.apiKeys
+	config.Rules = settings.rules
+	config.Routes = settings.routes
+	config.Headers = HeadersConfig(c.Headers)
+	config.Rejection = c.rejection()
+	config.Namespace = c.Namespace
+
+	// The combinations of the settings are checked the same way the middlewares check them
+	if _, err := config.middlewareSettings(); err != nil {
+		if config.APIKeys != nil {
+			config.APIKeys.Stop()
+		}
+		return DistributedRateLimiterConfig{}, err
+	}
+	return config, nil
+}
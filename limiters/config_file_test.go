@@ -0,0 +1,372 @@
+package limiters
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFileInterpolatesEnv(t *testing.T) {
+	secrets := []struct {
+		name  string
+		value string
+	}{
+		{"quote", `pa"ss`},
+		{"backslash", `pa\ss\n`},
+		{"hash", `pa # ss`},
+		{"colon", `pa: ss`},
+		{"braces", `${NOT_EXPANDED_AGAIN}`},
+	}
+	files := []struct {
+		extension string
+		content   string
+	}{
+		{".yaml", `
+backend: distributed
+target_url: http://localhost:8081
+# ${UNSET_IN_COMMENT} is ignored
+redis:
+  address: ${TEST_REDIS_ADDR:-localhost:6379}
+  password: ${TEST_REDIS_PASSWORD}
+key:
+  header: X-ID
+`},
+		{".json", `{
+  "backend": "distributed",
+  "target_url": "http://localhost:8081",
+  "redis": {"address": "${TEST_REDIS_ADDR:-localhost:6379}", "password": "${TEST_REDIS_PASSWORD}"},
+  "key": {"header": "X-ID"}
+}`},
+		{".toml", `
+backend = "distributed"
+target_url = "http://localhost:8081"
+# ${UNSET_IN_COMMENT} is ignored
+
+[redis]
+address = "${TEST_REDIS_ADDR:-localhost:6379}"
+password = "${TEST_REDIS_PASSWORD}"
+
+[key]
+header = "X-ID"
+`},
+	}
+
+	for _, file := range files {
+		for _, secret := range secrets {
+			t.Run(file.extension+"/"+secret.name, func(t *testing.T) {
+				t.Setenv("TEST_REDIS_PASSWORD", secret.value)
+
+				config, err := ParseConfigFile([]byte(file.content), file.extension)
+				if err != nil {
+					t.Fatalf("ParseConfigFile: %v", err)
+				}
+				if config.Redis.Password != secret.value {
+					t.Errorf("password = %q, want %q", config.Redis.Password, secret.value)
+				}
+				if config.Redis.Address != "localhost:6379" {
+					t.Errorf("address = %q, want the default localhost:6379", config.Redis.Address)
+				}
+			})
+		}
+	}
+}
+
+func TestParseConfigFileEnvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing variable",
+			content: "target_url: ${TEST_TARGET_URL}\nkey:\n  header: X-ID\n",
+			wantErr: "environment variable TEST_TARGET_URL is not set",
+		},
+		{
+			name:    "value is validated",
+			content: "target_url: ${TEST_TARGET_URL}\nkey:\n  header: X-ID\n",
+			env:     map[string]string{"TEST_TARGET_URL": "not a url"},
+			wantErr: "target_url: must be an absolute URL",
+		},
+		{
+			name:    "set variable",
+			content: "target_url: ${TEST_TARGET_URL}\nkey:\n  header: ${TEST_HEADER:-X-ID}\n",
+			env:     map[string]string{"TEST_TARGET_URL": "http://localhost:8081"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			config, err := ParseConfigFile([]byte(tt.content), ".yaml")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseConfigFile: %v", err)
+				}
+				if config.TargetURL != tt.env["TEST_TARGET_URL"] || config.Key.Header != "X-ID" {
+					t.Errorf("got target_url %q and header %q", config.TargetURL, config.Key.Header)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConfigFileFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		extension string
+		content   string
+		wantErr   string
+	}{
+		{name: "yaml", extension: ".yaml", content: "target_url: http://localhost:8081\nkey:\n  header: X-ID\nwindow: 1m\n"},
+		{name: "yml in upper case", extension: ".YML", content: "target_url: http://localhost:8081\nkey:\n  header: X-ID\n"},
+		{name: "json", extension: ".json", content: `{"target_url": "http://localhost:8081", "key": {"header": "X-ID"}, "window": "1m"}`},
+		{name: "toml", extension: ".toml", content: "target_url = \"http://localhost:8081\"\nwindow = \"1m\"\n[key]\nheader = \"X-ID\"\n"},
+		{
+			name:      "unknown yaml field",
+			extension: ".yaml",
+			content:   "target_url: http://localhost:8081\ncapacty: 10\nkey:\n  header: X-ID\n",
+			wantErr:   "field capacty not found",
+		},
+		{
+			name:      "unknown json field",
+			extension: ".json",
+			content:   `{"target_url": "http://localhost:8081", "capacty": 10, "key": {"header": "X-ID"}}`,
+			wantErr:   `unknown field "capacty"`,
+		},
+		{
+			name:      "unknown toml field",
+			extension: ".toml",
+			content:   "target_url = \"http://localhost:8081\"\ncapacty = 10\n[key]\nheader = \"X-ID\"\n",
+			wantErr:   `unknown field "capacty"`,
+		},
+		{
+			name:      "invalid duration",
+			extension: ".yaml",
+			content:   "target_url: http://localhost:8081\nwindow: a minute\nkey:\n  header: X-ID\n",
+			wantErr:   `invalid duration "a minute"`,
+		},
+		{
+			name:      "unsupported extension",
+			extension: ".ini",
+			content:   "target_url = http://localhost:8081\n",
+			wantErr:   `unsupported config file extension ".ini"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfigFile([]byte(tt.content), tt.extension)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseConfigFile: %v", err)
+			}
+			if config.TargetURL != "http://localhost:8081" || config.Key.Header != "X-ID" {
+				t.Errorf("got target_url %q and header %q", config.TargetURL, config.Key.Header)
+			}
+			if config.Window != nil && time.Duration(*config.Window) != time.Minute {
+				t.Errorf("window = %v, want 1m", time.Duration(*config.Window))
+			}
+		})
+	}
+}
+
+func TestFileConfigValidate(t *testing.T) {
+	// Every case starts from a valid config and adds the lines under test
+	const valid = "target_url: http://localhost:8081\nkey:\n  header: X-ID\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		wantErrs []string
+	}{
+		{name: "valid", content: valid},
+		{
+			name:     "missing target URL and key",
+			content:  "capacity: 10\n",
+			wantErrs: []string{"target_url: is required", "key: set at least one of"},
+		},
+		{
+			name:     "relative target URL",
+			content:  "target_url: /api\nkey:\n  header: X-ID\n",
+			wantErrs: []string{`target_url: must be an absolute URL like http://localhost:8080, got "/api"`},
+		},
+		{
+			name:     "unknown backend",
+			content:  valid + "backend: memcached\n",
+			wantErrs: []string{`backend: must be "local" or "distributed", got "memcached"`},
+		},
+		{
+			name:    "limits must be positive",
+			content: valid + "capacity: 0\nrefill_rate: -1\nmax_entries: -5\ncleanup_interval: 0s\n",
+			wantErrs: []string{
+				"capacity: must be greater than zero, got 0",
+				"refill_rate: must be greater than zero, got -1",
+				"max_entries: must be greater than zero, got -5",
+				"cleanup_interval: must be greater than zero, got 0s",
+			},
+		},
+		{
+			name:    "window algorithm needs no refill rate",
+			content: valid + "algorithm: fixed-window\nrefill_rate: 0\nwindow_unit: hour\nlocation: Europe/Berlin\n",
+		},
+		{
+			name:     "unknown algorithm, window unit and time zone",
+			content:  valid + "algorithm: leaky-bucket\nwindow_unit: week\nlocation: Mars/Olympus\n",
+			wantErrs: []string{`algorithm: must be one of`, `window_unit: must be one of`, `location: unknown time zone "Mars/Olympus"`},
+		},
+		{
+			name:     "GCRA on the local backend",
+			content:  valid + "algorithm: gcra\n",
+			wantErrs: []string{`algorithm: "gcra" is only supported by the distributed backend`},
+		},
+		{
+			name:     "distributed backend without Redis",
+			content:  valid + "backend: distributed\nalgorithm: gcra\nredis:\n  db: -1\n",
+			wantErrs: []string{"redis.address: is required for the distributed backend", "redis.db: must not be negative, got -1"},
+		},
+		{
+			name:     "trusted proxies without client IP",
+			content:  valid + "  trusted_proxies: [10.0.0.0/8]\n",
+			wantErrs: []string{"key.trusted_proxies: requires client_ip"},
+		},
+		{
+			name:    "queue, concurrency and adaptive settings",
+			content: valid + "queue:\n  max_queue_depth: 0\n  max_wait: -1s\nconcurrency:\n  max_in_flight: -1\nadaptive:\n  decrease_factor: 1.5\n",
+			wantErrs: []string{
+				"queue.max_queue_depth: must be greater than zero, got 0",
+				"queue.max_wait: must be greater than zero, got -1s",
+				"concurrency.max_in_flight: must not be negative, got -1",
+				"adaptive.decrease_factor: must be between 0 and 1, got 1.5",
+			},
+		},
+		{
+			name:     "lease time below the minimum",
+			content:  valid + "concurrency:\n  max_in_flight: 1\n  lease_time: 1ms\n",
+			wantErrs: []string{"concurrency.lease_time: must be at least 100ms, got 1ms"},
+		},
+		{
+			name:     "enabled global bucket without limits",
+			content:  valid + "global:\n  enabled: true\n",
+			wantErrs: []string{"global.capacity: must be greater than zero, got 0", "global.refill_rate: must be greater than zero, got 0"},
+		},
+		{
+			name:     "rejection settings",
+			content:  valid + "rejection:\n  format: xml\n  status: 200\n",
+			wantErrs: []string{`rejection.format: must be text, json or problem, got "xml"`, "rejection.status: must be between 400 and 599, got 200"},
+		},
+		{
+			name:     "API keys without a file",
+			content:  valid + "api_keys:\n  poll_interval: 10s\n",
+			wantErrs: []string{"api_keys.file: is required"},
+		},
+		{
+			name:     "rules",
+			content:  valid + "rules:\n  - name: second\n    capacity: 10\n    refill_rate: 10\n  - name: second\n    capacity: 0\n    refill_rate: 1\n",
+			wantErrs: []string{`rules[1].name: duplicate name "second"`, "rules[1].capacity: must be greater than zero, got 0"},
+		},
+		{
+			name:    "routes",
+			content: valid + "routes:\n  - path: /api\n    path_match: exact\n    capacity: 10\n    refill_rate: 1\n  - name: health\n    path: /health\n    unlimited: true\n  - name: search\n    path: \"[\"\n    path_match: regex\n    capacity: 10\n    refill_rate: 1\n",
+			wantErrs: []string{
+				"routes[0].name: is required",
+				`routes[0].path_match: must be "prefix", "glob" or "regex", got "exact"`,
+				"routes[2].path: invalid regular expression",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigFile([]byte(tt.content), ".yaml")
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("ParseConfigFile: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.wantErrs)
+			}
+
+			// All the problems are reported at once, one per line
+			if got := strings.Count(err.Error(), "\n  - "); got != len(tt.wantErrs) {
+				t.Errorf("got %d errors, want %d: %v", got, len(tt.wantErrs), err)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileConfigConversion(t *testing.T) {
+	content := `
+target_url: http://localhost:8081
+capacity: 20
+algorithm: sliding-window-log
+window: 30s
+key:
+  header: X-ID
+  default: anonymous
+queue:
+  enabled: true
+  max_wait: 2s
+rules:
+  - name: hourly
+    capacity: 1000
+    algorithm: fixed-window
+    window_unit: hour
+routes:
+  - name: health
+    path: /health
+    unlimited: true
+`
+	config, err := ParseConfigFile([]byte(content), ".yaml")
+	if err != nil {
+		t.Fatalf("ParseConfigFile: %v", err)
+	}
+
+	local, err := config.LocalConfig()
+	if err != nil {
+		t.Fatalf("LocalConfig: %v", err)
+	}
+	defaults := GetLocalRateLimiterDefaultConfig()
+	if local.Capacity != 20 || local.RefillRate != defaults.RefillRate {
+		t.Errorf("capacity, refill rate = %d, %v, want 20, %v", local.Capacity, local.RefillRate, defaults.RefillRate)
+	}
+	if local.Algorithm != SlidingWindowLog || local.Window != 30*time.Second {
+		t.Errorf("algorithm, window = %s, %v, want %s, 30s", local.Algorithm, local.Window, SlidingWindowLog)
+	}
+	if local.UniqueHeaderNameInRequest != "X-ID" || local.DefaultKey != "anonymous" {
+		t.Errorf("header, default key = %q, %q, want X-ID, anonymous", local.UniqueHeaderNameInRequest, local.DefaultKey)
+	}
+	if !local.Queue.Enabled || local.Queue.MaxWait != 2*time.Second || local.Queue.MaxQueueDepth != defaults.Queue.MaxQueueDepth {
+		t.Errorf("queue = %+v, want enabled with a wait of 2s and the default depth", local.Queue)
+	}
+	if len(local.Rules) != 1 || local.Rules[0].Name != "hourly" || local.Rules[0].Algorithm != FixedWindow {
+		t.Errorf("rules = %+v, want the hourly fixed window", local.Rules)
+	}
+	if len(local.Routes) != 1 || local.Routes[0].Name != "health" || !local.Routes[0].Unlimited {
+		t.Errorf("routes = %+v, want the unlimited health route", local.Routes)
+	}
+
+	if _, err := config.DistributedConfig(); err == nil {
+		t.Error("DistributedConfig of a local config file did not fail")
+	}
+}
@@ -0,0 +1,55 @@
+package limiters
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// CostFunc returns the number of tokens a request costs
+// Requests are charged one token each when no CostFunc is set
+type CostFunc func(r *http.Request) int
+
+// FixedCost charges every request the same number of tokens
+func FixedCost(tokens int) CostFunc {
+	return func(r *http.Request) int {
+		return tokens
+	}
+}
+
+// RouteCost charges requests by route
+// Routes are written as "METHOD /path" or "/path" - e.g. "POST /export" - and matched exactly,
+// the method specific route first. Requests matching no route cost defaultCost
+func RouteCost(costs map[string]int, defaultCost int) CostFunc {
+	return func(r *http.Request) int {
+		if cost, ok := costs[r.Method+" "+r.URL.Path]; ok {
+			return cost
+		}
+		if cost, ok := costs[r.URL.Path]; ok {
+			return cost
+		}
+		return defaultCost
+	}
+}
+
+// HeaderCost reads the cost from a request header, e.g. one set by an upstream gateway
+// Requests without the header or with a value that is not a whole number cost defaultCost
+func HeaderCost(header string, defaultCost int) CostFunc {
+	return func(r *http.Request) int {
+		cost, err := strconv.Atoi(r.Header.Get(header))
+		if err != nil || cost < 0 {
+			return defaultCost
+		}
+		return cost
+	}
+}
+
+// ContentLengthCost charges one token per bytesPerToken bytes of request body, rounded up
+// Every request costs at least one token, including the ones without a known Content-Length
+func ContentLengthCost(bytesPerToken int64) CostFunc {
+	return func(r *http.Request) int {
+		if r.ContentLength <= 0 || bytesPerToken <= 0 {
+			return 1
+		}
+		return int((r.ContentLength + bytesPerToken - 1) / bytesPerToken)
+	}
+}
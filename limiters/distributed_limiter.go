@@ -1,7 +1,7 @@
 package limiters
 
 import (
-	"log"
+	"fmt"
 	"time"
 
 	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
@@ -9,16 +9,35 @@ import (
 
 // DistributedRateLimiterConfig holds configuration for both implementations
 type DistributedRateLimiterConfig struct {
-	CleanupInterval           time.Duration // Time interval to clean up expired buckets
-	ExpirationTime            time.Duration // Time after which a bucket expires
-	Capacity                  int           // Capacity of each bucket
-	RefillRate                int           // Refill rate of each bucket
-	TargetURL                 string        // Target URL for reverse proxy
-	UniqueHeaderNameInRequest string        // Unique header name in request
-	RedisDBAddress            string        // Redis DB address
-	RedisDBPassword           string        // Redis DB password
-	StorageDB                 int           // Redis DB number
-	KeyPrefix                 string        // Redis key prefix - used for multiple instances
+	CleanupInterval           time.Duration     // Time interval to clean up expired buckets
+	ExpirationTime            time.Duration     // Time after which a bucket expires
+	Capacity                  int               // Capacity of each bucket
+	RefillRate                float64           // Refill rate of each bucket in tokens per second - fractions allowed
+	TargetURL                 string            // Target URL for reverse proxy
+	UniqueHeaderNameInRequest string            // Unique header name in request
+	RedisDBAddress            string            // Redis DB address
+	RedisDBPassword           string            // Redis DB password
+	StorageDB                 int               // Redis DB number
+	KeyPrefix                 string            // Redis key prefix - used for multiple instances
+	Algorithm                 Algorithm         // Rate limiting algorithm - TokenBucket, GCRA, SlidingWindowLog, SlidingWindowCounter or FixedWindow
+	Window                    time.Duration     // Window length for the window based algorithms - Capacity requests are allowed per window
+	WindowUnit                WindowUnit        // Calendar unit the FixedWindow windows align to (minute, hour, day, month) - overrides Window
+	Location                  *time.Location    // Time zone of the calendar windows - defaults to UTC
+	Queue                     QueueConfig       // Queueing mode - hold requests until they can be allowed instead of rejecting them
+	Concurrency               ConcurrencyConfig // In-flight request limits per key and across all keys
+	Adaptive                  AdaptiveConfig    // Adaptive mode - lower the refill rate while the target is unhealthy
+	Cost                      CostFunc          // Tokens a request costs - one token per request when nil
+	Resolver                  LimitResolver     // Capacity, refill rate and cost per key - every key gets Capacity and RefillRate when nil
+	KeyFunc                   KeyFunc           // Extracts the key of a request - the UniqueHeaderNameInRequest header when nil
+	DefaultKey                string            // Key of the requests without one - they are rejected with 400 when empty
+	APIKeys                   *APIKeyStore      // Known API keys with their own limits and daily quotas - any key is accepted when nil
+	Rules                     []Rule            // Limits every key is held to at once, e.g. per second, hour and day - replace Capacity and RefillRate when set
+	Hierarchy                 HierarchyConfig   // Parent level above the key of every request, e.g. an organisation ceiling above its users
+	Global                    GlobalConfig      // Bucket shared by all the requests on top of the bucket of each key
+	Routes                    []Route           // Routes with their own limits, key and cost, matched in order - the config is the default route
+	Headers                   HeadersConfig     // Rate limit headers of the responses - RateLimit-* by default, X-RateLimit-* with Legacy
+	Rejection                 RejectionConfig   // Responses of the rejected requests - plain text 429 by default, JSON or problem details
+	Namespace                 string            // Prefix of the buckets - lets several middlewares share one rate limiter with their own buckets
 }
 
 // GetDistributedRateLimiterDefaultConfig returns the default configuration for the distributed rate limiter
@@ -33,12 +52,30 @@ func GetDistributedRateLimiterDefaultConfig() DistributedRateLimiterConfig {
 		KeyPrefix:       "ratelimit",
 		Capacity:        20,
 		RefillRate:      1,
+		Algorithm:       TokenBucket,
+		Window:          1 * time.Minute,
+		Queue: QueueConfig{
+			Enabled:       false,
+			MaxQueueDepth: 100,
+			MaxWait:       5 * time.Second,
+		},
+		Adaptive: AdaptiveConfig{
+			Enabled:        false,
+			MinRefillRate:  0.1,
+			DecreaseFactor: 0.5,
+			IncreaseStep:   0.1,
+		},
+		Concurrency: ConcurrencyConfig{
+			LeaseTime: 30 * time.Second,
+		},
 	}
 
 	return config
 }
 
 // CreateDistributedRateLimiter creates the appropriate rate limiter based on the configuration
+// It implements Limiter - Allow checks every key against the Capacity and RefillRate of the config.
+// It returns an error wrapping ErrBackendUnavailable when Redis cannot be reached and ErrInvalidConfig for an invalid config
 func CreateDistributedRateLimiter(config DistributedRateLimiterConfig) (*rate_limiter.DistributedRateLimiter, error) {
 
 	rateLimiter, err := rate_limiter.NewDistributedRateLimiter(
@@ -48,9 +85,19 @@ func CreateDistributedRateLimiter(config DistributedRateLimiterConfig) (*rate_li
 		config.KeyPrefix,
 		config.CleanupInterval,
 		config.ExpirationTime,
+		rate_limiter.AlgorithmConfig{
+			Algorithm:  config.Algorithm,
+			Window:     config.Window,
+			WindowUnit: config.WindowUnit,
+			Location:   config.Location,
+		},
+		rate_limiter.Limits{
+			Capacity:   config.Capacity,
+			RefillRate: config.RefillRate,
+		},
 	)
 	if err != nil {
-		log.Fatalf("Failed to initialize distributed rate limiter: %v", err)
+		return nil, invalidConfig(fmt.Errorf("failed to initialize distributed rate limiter: %w", err))
 	}
 
 	return rateLimiter, nil
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/krishpatel023/ratelimiter/internal/helper"
 	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
 	"github.com/redis/go-redis/v9"
 )
@@ -15,53 +14,79 @@ import (
 // the allowed requests. Based on the response will either decline or forward the request.
 // It is also responsible for the reverse proxy setup and the forwarding of the request if the
 // request is allowed
-func DistributedRateLimitingMiddleware(rl *rate_limiter.DistributedRateLimiter, config DistributedRateLimiterConfig) http.Handler {
+// Any Limiter can be used, e.g. a local rate limiter in tests.
+// An invalid config returns an error wrapping ErrInvalidTargetURL, ErrMissingKeyHeader or ErrInvalidConfig,
+// and ErrBackendUnavailable is returned when Redis cannot be reached
+func DistributedRateLimitingMiddleware(rl Limiter, config DistributedRateLimiterConfig) (http.Handler, error) {
 	// Create a reverse proxy
-	handler := reverseProxy(config.TargetURL)
-	if handler == nil {
-		return nil
+	handler, err := reverseProxy(config.TargetURL)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if the UniqueHeaderNameInRequest header is present
-	if config.UniqueHeaderNameInRequest == "" {
-		helper.Log("Request rejected: Set UniqueHeaderNameInRequest header in config", "warning")
-		http.Error(nil, "Set UniqueHeaderNameInRequest header in config", http.StatusBadRequest)
-		return nil
+	settings, err := config.middlewareSettings()
+	if err != nil {
+		return nil, err
 	}
 
 	// Check if the redis connection is working
-	connection, err := RedisCheck(config.RedisDBAddress, config.RedisDBPassword, config.StorageDB)
-	if !connection || err != nil {
-		helper.Log("Request rejected: Redis connection failed", "warning")
-		return nil
+	backend, err := bindLimiter(rl, settings)
+	if err != nil {
+		return nil, err
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.Header.Get(config.UniqueHeaderNameInRequest)
-		if requestID == "" {
-			http.Error(w, "Missing "+config.UniqueHeaderNameInRequest+" header", http.StatusBadRequest)
-			helper.Log("Request rejected: Missing "+config.UniqueHeaderNameInRequest+" header", "warning")
-			return
-		}
-
-		// Can add a function to get dynamic rate limit config
-		// totalTokenPerUser, refillRate := getRateLimiterConfig(requestID)
+	return rateLimitHandler(backend, settings, handler), nil
+}
 
-		// Get rate limit config
-		token_per_req, total_token, refill_rate := 1, config.Capacity, config.RefillRate
+// middlewareSettings builds the request handling settings from the distributed config
+// The errors wrap ErrMissingKeyHeader or ErrInvalidConfig
+func (config DistributedRateLimiterConfig) middlewareSettings() (middlewareSettings, error) {
+	settings, err := config.settings()
+	return settings, invalidConfig(err)
+}
 
-		allowed := rl.AllowRequest(requestID, token_per_req, total_token, refill_rate)
-		if !allowed {
-			http.Error(w, "Too many requests", http.StatusTooManyRequests)
-			helper.Log("Request blocked - RequestID: "+requestID, "warning")
-			return
-		}
+// settings validates the distributed config and builds its settings
+func (config DistributedRateLimiterConfig) settings() (middlewareSettings, error) {
+	return middlewareSettings{
+		headerName:  config.UniqueHeaderNameInRequest,
+		capacity:    config.Capacity,
+		refillRate:  config.RefillRate,
+		algorithm:   config.Algorithm,
+		window:      config.Window,
+		windowUnit:  config.WindowUnit,
+		location:    config.Location,
+		queueConfig: config.Queue,
+		concurrency: config.Concurrency,
+		adaptive:    config.Adaptive,
+		cost:        config.Cost,
+		resolver:    config.Resolver,
+		keyFunc:     config.KeyFunc,
+		defaultKey:  config.DefaultKey,
+		apiKeys:     config.APIKeys,
+		rules:       config.Rules,
+		hierarchy:   config.Hierarchy,
+		global:      config.Global,
+		routeConfig: config.Routes,
+		headers:     config.Headers,
+		rejection:   config.Rejection,
+		namespace:   config.Namespace,
+	}.build()
+}
 
-		helper.Log("Request allowed - RequestID: "+requestID, "info")
-		handler.ServeHTTP(w, r)
-	})
+// distributedBackend binds the middlewares to the distributed rate limiter
+// The in-flight slots are leases of leaseTime
+func distributedBackend(rl *rate_limiter.DistributedRateLimiter, leaseTime time.Duration) limiterBackend {
+	return limiterBackend{
+		allowWithAlgorithm: rl.AllowRequestWithAlgorithm,
+		allowLevels:        rl.AllowRequestLevels,
+		acquire: func(ctx context.Context, id string, perKey, global int) (func(), bool, error) {
+			return rl.AcquireSlot(ctx, id, perKey, global, leaseTime)
+		},
+		adjust: rl.AdjustRefillRate,
+	}
 }
 
+// RedisCheck checks that Redis can be reached, retrying for a few seconds
 func RedisCheck(redisAddr, password string, db int) (bool, error) {
 
 	// Create Redis client
@@ -0,0 +1,39 @@
+package limiters
+
+import (
+	"errors"
+	"fmt"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// Errors returned by the constructors of the rate limiters and the middlewares
+// They are wrapped with the details of the failure - check them with errors.Is:
+//
+//	handler, err := limiters.LocalRateLimitingMiddleware(rl, config)
+//	if errors.Is(err, limiters.ErrInvalidTargetURL) {
+//		...
+//	}
+var (
+	// ErrMissingKeyHeader means the config sets neither UniqueHeaderNameInRequest nor KeyFunc
+	ErrMissingKeyHeader = errors.New("set UniqueHeaderNameInRequest header or KeyFunc in config")
+	// ErrInvalidTargetURL means the TargetURL of the reverse proxy is not an absolute URL
+	ErrInvalidTargetURL = errors.New("invalid TargetURL")
+	// ErrBackendUnavailable means the rate limiter cannot reach its storage, e.g. Redis is down
+	ErrBackendUnavailable = rate_limiter.ErrBackendUnavailable
+	// ErrInvalidConfig means a setting of the config is invalid, e.g. a negative capacity
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// invalidConfig wraps a validation error with ErrInvalidConfig
+// Errors that already are one of the errors above are returned as they are
+func invalidConfig(err error) error {
+	if err == nil ||
+		errors.Is(err, ErrMissingKeyHeader) ||
+		errors.Is(err, ErrInvalidTargetURL) ||
+		errors.Is(err, ErrBackendUnavailable) ||
+		errors.Is(err, ErrInvalidConfig) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+}
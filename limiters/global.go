@@ -0,0 +1,41 @@
+package limiters
+
+import (
+	"fmt"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// globalLevelName names the global level in rejections and in the name of its bucket
+const globalLevelName = "global"
+
+// GlobalConfig is a ceiling for all the requests together, on top of the bucket of each key
+// It protects the target when many distinct keys each stay within their own limit.
+// The bucket lives in memory with the local rate limiter and in a single Redis key shared by all
+// the instances with the distributed one
+type GlobalConfig struct {
+	Enabled    bool    // Enable the global bucket
+	Capacity   int     // Capacity of the global bucket
+	RefillRate float64 // Tokens added to the global bucket per second
+}
+
+// validate checks the limits of the global bucket
+func (config GlobalConfig) validate() error {
+	if config.Capacity <= 0 || config.RefillRate <= 0 {
+		return fmt.Errorf("Global.Capacity and Global.RefillRate must be greater than zero")
+	}
+	return nil
+}
+
+// level returns the level of the global bucket
+// Its id is empty, which no request key can be, so it never shares a bucket with a key
+func (config GlobalConfig) level() rate_limiter.Level {
+	return rate_limiter.Level{
+		ID: "",
+		Rule: Rule{
+			Name:       globalLevelName,
+			Capacity:   config.Capacity,
+			RefillRate: config.RefillRate,
+		},
+	}
+}
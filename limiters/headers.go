@@ -0,0 +1,93 @@
+package limiters
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	fixed_window "github.com/krishpatel023/ratelimiter/internal/fixed-window"
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// HeadersConfig selects the rate limit headers sent with the responses
+// The IETF RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers are sent
+// with every allowed or rate limited response, and Retry-After with every 429
+type HeadersConfig struct {
+	Disabled bool // Send no RateLimit-* headers - Retry-After is still sent with the 429s
+	Legacy   bool // Also send X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset - the reset as a Unix time
+}
+
+// rateLimitHeaders are the headers write can set
+// The reverse proxy drops the ones of the target the middleware already set, so they are not sent twice
+var rateLimitHeaders = []string{
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+}
+
+// write sets the rate limit headers of the decision
+// policy describes the quotas the request was checked against, e.g. 10;w=1, 1000;w=3600
+func (config HeadersConfig) write(header http.Header, result rate_limiter.Result, policy string) {
+	if config.Disabled {
+		return
+	}
+
+	limit := strconv.Itoa(result.Limit)
+	remaining := strconv.Itoa(max(0, result.Remaining))
+	header.Set("RateLimit-Limit", limit)
+	header.Set("RateLimit-Remaining", remaining)
+	header.Set("RateLimit-Reset", strconv.FormatInt(seconds(result.ResetAfter), 10))
+	if policy != "" {
+		header.Set("RateLimit-Policy", policy)
+	}
+
+	if config.Legacy {
+		header.Set("X-RateLimit-Limit", limit)
+		header.Set("X-RateLimit-Remaining", remaining)
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.ResetAfter).Unix(), 10))
+	}
+}
+
+// writeRetryAfter sets the Retry-After header of a 429 - at least a second, so clients do not retry right away
+func writeRetryAfter(header http.Header, retryAfter time.Duration) {
+	header.Set("Retry-After", strconv.FormatInt(max(1, seconds(retryAfter)), 10))
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// policy describes the quota of a rule as in the RateLimit-Policy header - its capacity and window in seconds
+// The window of the token buckets is the time an empty bucket takes to fill up again
+func policy(rule Rule) string {
+	var window time.Duration
+	switch rule.Algorithm {
+	case SlidingWindowLog, SlidingWindowCounter:
+		window = rule.Window
+	case FixedWindow:
+		start, end := fixed_window.Bounds(time.Now(), rule.WindowUnit, rule.Window, rule.Location)
+		window = end.Sub(start)
+	default:
+		if rule.RefillRate > 0 {
+			window = time.Duration(float64(rule.Capacity) / rule.RefillRate * float64(time.Second))
+		}
+	}
+
+	if window <= 0 {
+		return strconv.Itoa(rule.Capacity)
+	}
+	return strconv.Itoa(rule.Capacity) + ";w=" + strconv.FormatInt(seconds(window), 10)
+}
+
+// levelsPolicy describes the quotas of all the levels a request is checked against
+func levelsPolicy(levels []rate_limiter.Level) string {
+	policies := make([]string, 0, len(levels))
+	for _, level := range levels {
+		policies = append(policies, policy(level.Rule))
+	}
+	return strings.Join(policies, ", ")
+}
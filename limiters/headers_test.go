@@ -0,0 +1,167 @@
+package limiters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+func TestHeadersConfigWrite(t *testing.T) {
+	result := rate_limiter.Result{Allowed: true, Limit: 10, Remaining: 7, ResetAfter: 2500 * time.Millisecond}
+
+	tests := []struct {
+		name   string
+		config HeadersConfig
+		result rate_limiter.Result
+		policy string
+		want   map[string]string
+	}{
+		{
+			name:   "default",
+			result: result,
+			policy: "10;w=10",
+			want:   map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7", "RateLimit-Reset": "3", "RateLimit-Policy": "10;w=10"},
+		},
+		{
+			name:   "no policy",
+			result: result,
+			want:   map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7", "RateLimit-Reset": "3"},
+		},
+		{
+			name:   "negative remaining",
+			result: rate_limiter.Result{Limit: 10, Remaining: -2},
+			want:   map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "0", "RateLimit-Reset": "0"},
+		},
+		{
+			name:   "disabled",
+			config: HeadersConfig{Disabled: true, Legacy: true},
+			result: result,
+			policy: "10;w=10",
+			want:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			tt.config.write(header, tt.result, tt.policy)
+
+			if len(header) != len(tt.want) {
+				t.Errorf("headers = %v, want %v", header, tt.want)
+			}
+			for name, value := range tt.want {
+				if got := header.Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadersConfigWriteLegacy(t *testing.T) {
+	header := http.Header{}
+	HeadersConfig{Legacy: true}.write(header, rate_limiter.Result{Limit: 10, Remaining: 4, ResetAfter: time.Minute}, "")
+
+	if header.Get("X-RateLimit-Limit") != "10" || header.Get("X-RateLimit-Remaining") != "4" {
+		t.Errorf("legacy limit, remaining = %q, %q, want 10, 4", header.Get("X-RateLimit-Limit"), header.Get("X-RateLimit-Remaining"))
+	}
+
+	// The legacy reset is the Unix time of the reset instead of the seconds left
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if want := time.Now().Add(time.Minute).Unix(); err != nil || reset < want-1 || reset > want {
+		t.Errorf("X-RateLimit-Reset = %q, want %d", header.Get("X-RateLimit-Reset"), want)
+	}
+	if header.Get("RateLimit-Reset") != "60" {
+		t.Errorf("RateLimit-Reset = %q, want 60", header.Get("RateLimit-Reset"))
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int64
+	}{
+		{d: -time.Second, want: 0},
+		{d: 0, want: 0},
+		{d: time.Nanosecond, want: 1},
+		{d: time.Second, want: 1},
+		{d: 1500 * time.Millisecond, want: 2},
+		{d: time.Hour, want: 3600},
+	}
+	for _, tt := range tests {
+		if got := seconds(tt.d); got != tt.want {
+			t.Errorf("seconds(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+
+	// Retry-After never tells clients to retry right away
+	header := http.Header{}
+	writeRetryAfter(header, 0)
+	if header.Get("Retry-After") != "1" {
+		t.Errorf("Retry-After of a zero wait = %q, want 1", header.Get("Retry-After"))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{name: "token bucket fills up in capacity over refill rate", rule: Rule{Capacity: 10, RefillRate: 2}, want: "10;w=5"},
+		{name: "partial seconds round up", rule: Rule{Capacity: 3, RefillRate: 2}, want: "3;w=2"},
+		{name: "no refill rate has no window", rule: Rule{Capacity: 10}, want: "10"},
+		{name: "sliding window", rule: Rule{Capacity: 5, Algorithm: SlidingWindowLog, Window: time.Minute}, want: "5;w=60"},
+		{name: "fixed window", rule: Rule{Capacity: 100, Algorithm: FixedWindow, Window: 10 * time.Second}, want: "100;w=10"},
+		{name: "calendar window", rule: Rule{Capacity: 1000, Algorithm: FixedWindow, WindowUnit: WindowHour}, want: "1000;w=3600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy(tt.rule); got != tt.want {
+				t.Errorf("policy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	levels := []rate_limiter.Level{{Rule: Rule{Capacity: 10, RefillRate: 1}}, {Rule: Rule{Capacity: 1000, Algorithm: FixedWindow, WindowUnit: WindowHour}}}
+	if got, want := levelsPolicy(levels), "10;w=10, 1000;w=3600"; got != want {
+		t.Errorf("levelsPolicy = %q, want %q", got, want)
+	}
+}
+
+func TestReverseProxyDropsTargetHeaders(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "999")
+		w.Header().Set("RateLimit-Remaining", "998")
+		w.Header().Set("X-RateLimit-Limit", "999")
+		w.Header().Set("X-Target", "kept")
+	}))
+	defer target.Close()
+
+	proxy, err := reverseProxy(target.URL)
+	if err != nil {
+		t.Fatalf("reverseProxy: %v", err)
+	}
+
+	// The middleware sets the RateLimit headers before the request is proxied
+	w := httptest.NewRecorder()
+	HeadersConfig{}.write(w.Header(), rate_limiter.Result{Allowed: true, Limit: 10, Remaining: 9}, "")
+	proxy.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	want := map[string][]string{
+		"RateLimit-Limit":     {"10"},
+		"RateLimit-Remaining": {"9"},
+		"X-RateLimit-Limit":   {"999"}, // Not set by the middleware
+		"X-Target":            {"kept"},
+	}
+	for name, values := range want {
+		if got := w.Result().Header.Values(name); !reflect.DeepEqual(got, values) {
+			t.Errorf("%s = %q, want %q", name, got, values)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// keyLevelName names the level of the request key in rejections when it is held to a single limit
+const keyLevelName = "key"
+
+// HierarchyConfig puts a parent level above the key of every request, e.g. an organisation above its users
+// Every request draws from the bucket of its key and from the bucket shared by its parent, so one parent
+// cannot starve the others even when each of its keys is within its own limit.
+// Both levels are checked together - a request rejected by one level is not counted by the other
+type HierarchyConfig struct {
+	ParentKeyFunc KeyFunc // Extracts the parent key of a request, e.g. the organisation - the hierarchy is off when nil
+	Parent        Rule    // Limit shared by all the keys of a parent - its Name is reported when the parent level rejects
+}
+
+// enabled reports if requests are checked against a parent level
+func (config HierarchyConfig) enabled() bool {
+	return config.ParentKeyFunc != nil
+}
+
+// validate checks the rule of the parent level against the rules of the request key
+func (config HierarchyConfig) validate(rules []Rule) error {
+	if config.Parent.Name == keyLevelName && len(rules) == 0 {
+		return fmt.Errorf("Hierarchy.Parent name %q is reserved for the request key", keyLevelName)
+	}
+	if err := rate_limiter.ValidateRules(append([]Rule{config.Parent}, rules...)); err != nil {
+		return fmt.Errorf("hierarchy: %w", err)
+	}
+	return nil
+}
+
+// allowLevelsFunc checks a request against the rules of all its levels at once
+// It is satisfied by the AllowRequestLevels method of the distributed rate limiter
+type allowLevelsFunc func(ctx context.Context, levels []rate_limiter.Level, tokens int) (rate_limiter.Result, int, error)
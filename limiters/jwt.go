@@ -0,0 +1,377 @@
+package limiters
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// JWTConfig holds the settings of the bearer token key extraction
+// Tokens are read from the "Authorization: Bearer" header and verified before any of their claims is used,
+// so clients cannot pick their own key the way they could with a plain header
+type JWTConfig struct {
+	KeyClaim   string        // Claim the requests are keyed by, e.g. "sub" or "tenant_id"
+	TierClaim  string        // Claim holding the tier of the client - used by TierResolver
+	HMACSecret []byte        // Secret of the HS256, HS384 and HS512 tokens
+	JWKSFile   string        // Local JWKS file with the RSA and ECDSA public keys of the RS*, PS* and ES* tokens
+	Issuer     string        // Expected iss claim - not checked when empty
+	Audience   string        // Expected aud claim - not checked when empty
+	Leeway     time.Duration // Clock skew allowed when checking exp and nbf
+}
+
+// JWTVerifier verifies bearer tokens and keys the requests by one of their claims
+// Verified tokens are cached until they expire, so every token is only verified once
+type JWTVerifier struct {
+	config JWTConfig
+	keys   []jsonWebKey // Public keys loaded from the JWKS file
+	cache  *lru.Cache   // Claims of the verified tokens by token
+}
+
+// jsonWebKey is a public key of the JWKS file
+type jsonWebKey struct {
+	kid string
+	key crypto.PublicKey
+}
+
+// verifiedToken holds the claims of a verified token
+type verifiedToken struct {
+	claims    map[string]interface{}
+	expiresAt time.Time // Zero when the token has no exp claim
+}
+
+// errMissingBearerToken is returned by Claims for requests without a bearer token
+var errMissingBearerToken = errors.New("missing bearer token")
+
+// jwtAlgorithms maps the supported signing algorithms to their hash
+var jwtAlgorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// NewJWTVerifier creates a verifier from the config, loading the JWKS file if one is set
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.KeyClaim == "" {
+		return nil, fmt.Errorf("JWT KeyClaim must be set")
+	}
+	if len(config.HMACSecret) == 0 && config.JWKSFile == "" {
+		return nil, fmt.Errorf("JWT HMACSecret or JWKSFile must be set")
+	}
+
+	verifier := &JWTVerifier{config: config}
+
+	if config.JWKSFile != "" {
+		keys, err := loadJWKS(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keys = keys
+	}
+
+	cache, err := lru.New(10000)
+	if err != nil {
+		return nil, err
+	}
+	verifier.cache = cache
+
+	return verifier, nil
+}
+
+// KeyFunc keys requests by the KeyClaim of their bearer token
+// Requests without a token have no key and fall back to the DefaultKey, if any. Requests with a token that
+// fails verification, e.g. a forged signature or an expired token, are rejected with 401
+func (v *JWTVerifier) KeyFunc() KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		claims, err := v.Claims(r)
+		if errors.Is(err, errMissingBearerToken) {
+			return "", false
+		}
+		if err != nil {
+			return "", true
+		}
+		key := claimString(claims[v.config.KeyClaim])
+		return key, key != ""
+	}
+}
+
+// TierResolver gives every request the limit of the tier in the TierClaim of its token
+// Tokens without a known tier get the limit of defaultTier
+func (v *JWTVerifier) TierResolver(tiers map[string]Limit, defaultTier string) LimitResolver {
+	return LimitResolverFunc(func(key string, r *http.Request) (Limit, error) {
+		tier := defaultTier
+		if claims, err := v.Claims(r); err == nil && v.config.TierClaim != "" {
+			if value := claimString(claims[v.config.TierClaim]); value != "" {
+				if _, ok := tiers[value]; ok {
+					tier = value
+				}
+			}
+		}
+
+		limit, ok := tiers[tier]
+		if !ok {
+			return Limit{}, fmt.Errorf("no limit for tier %q", tier)
+		}
+		return limit, nil
+	})
+}
+
+// Claims returns the claims of the verified bearer token of the request
+func (v *JWTVerifier) Claims(r *http.Request) (map[string]interface{}, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, errMissingBearerToken
+	}
+	token = strings.TrimSpace(token)
+
+	now := time.Now()
+	if val, ok := v.cache.Get(token); ok {
+		verified := val.(verifiedToken)
+		if verified.expiresAt.IsZero() || now.Before(verified.expiresAt.Add(v.config.Leeway)) {
+			return verified.claims, nil
+		}
+		v.cache.Remove(token)
+		return nil, errors.New("token expired")
+	}
+
+	claims, err := v.verify(token, now)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := verifiedToken{claims: claims}
+	if exp, ok := claimTime(claims["exp"]); ok {
+		verified.expiresAt = exp
+	}
+	v.cache.Add(token, verified)
+	return claims, nil
+}
+
+// verify checks the signature and the registered claims of a token and returns its claims
+func (v *JWTVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	if exp, ok := claimTime(claims["exp"]); ok && !now.Before(exp.Add(v.config.Leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claimTime(claims["nbf"]); ok && now.Add(v.config.Leeway).Before(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	if v.config.Issuer != "" && claimString(claims["iss"]) != v.config.Issuer {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return nil, errors.New("unexpected token audience")
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature of the signed part of a token
+// The algorithm has to match the type of the key, so an RSA public key can never be used as an HMAC secret
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	hash, ok := jwtAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+
+	if strings.HasPrefix(alg, "HS") {
+		if len(v.config.HMACSecret) == 0 {
+			return fmt.Errorf("no HMAC secret for algorithm %q", alg)
+		}
+		mac := hmac.New(hash.New, v.config.HMACSecret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	for _, jwk := range v.keys {
+		if kid != "" && jwk.kid != "" && jwk.kid != kid {
+			continue
+		}
+		switch key := jwk.key.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil {
+				return nil
+			}
+			if strings.HasPrefix(alg, "PS") && rsa.VerifyPSS(key, hash, digest, signature, nil) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if strings.HasPrefix(alg, "ES") && len(signature) == 2*size {
+				r := new(big.Int).SetBytes(signature[:size])
+				s := new(big.Int).SetBytes(signature[size:])
+				if ecdsa.Verify(key, digest, r, s) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("invalid token signature")
+}
+
+// loadJWKS reads the RSA and EC signing keys of a JWKS file
+func loadJWKS(path string) ([]jsonWebKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	keys := make([]jsonWebKey, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+				return nil, fmt.Errorf("invalid RSA key %d in JWKS file", i)
+			}
+			key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			keys = append(keys, jsonWebKey{kid: k.Kid, key: key})
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve %q of key %d in JWKS file", k.Crv, i)
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("invalid EC key %d in JWKS file", i)
+			}
+			key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			keys = append(keys, jsonWebKey{kid: k.Kid, key: key})
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys in JWKS file %s", path)
+	}
+	return keys, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token, keeping numbers as json.Number
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// claimString returns a string or number claim as a string
+func claimString(claim interface{}) string {
+	switch value := claim.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return ""
+	}
+}
+
+// claimTime returns a NumericDate claim as a time
+func claimTime(claim interface{}) (time.Time, bool) {
+	number, ok := claim.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// hasAudience reports if the aud claim - a string or an array of strings - contains audience
+func hasAudience(claim interface{}, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, aud := range value {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package limiters
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner signs the tokens of the JWT tests
+type testSigner struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T) testSigner {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{secret: []byte("s3cret"), rsa: rsaKey, ec: ecKey}
+}
+
+// jwks writes the public keys of the signer to a JWKS file
+func (s testSigner) jwks(t *testing.T) string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	set := map[string]interface{}{"keys": []interface{}{
+		map[string]string{"kty": "RSA", "kid": "rsa", "n": encode(s.rsa.N.Bytes()), "e": encode(big.NewInt(int64(s.rsa.E)).Bytes())},
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(s.ec.X.FillBytes(make([]byte, 32))), "y": encode(s.ec.Y.FillBytes(make([]byte, 32)))},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign builds a token with the header and claims, signed the way signWith says - it may differ from the alg
+// of the header to forge tokens. "none" leaves the signature empty
+func (s testSigner) sign(t *testing.T, header map[string]string, claims map[string]interface{}, signWith string) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch signWith {
+	case "HS256":
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "HS256-public-key":
+		// The RSA public key used as an HMAC secret - the classic algorithm confusion attack
+		mac := hmac.New(sha256.New, s.rsa.N.Bytes())
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		signature, err = rsa.SignPSS(rand.Reader, s.rsa, crypto.SHA256, digest[:], nil)
+	case "ES256":
+		r, sig, signErr := ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		err = signErr
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), sig.FillBytes(make([]byte, 32))...)
+		}
+	case "none":
+	default:
+		t.Fatalf("unknown signing algorithm %q", signWith)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifierClaims(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier, err := NewJWTVerifier(JWTConfig{
+		KeyClaim:   "sub",
+		HMACSecret: signer.secret,
+		JWKSFile:   signer.jwks(t),
+		Issuer:     "https://issuer.example.com",
+		Audience:   "ratelimiter",
+		Leeway:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	now := time.Now()
+	valid := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://issuer.example.com",
+			"aud": []string{"other", "ratelimiter"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		header   map[string]string
+		claims   map[string]interface{}
+		signWith string
+		token    string // Used as is instead of signing the header and claims when set
+		wantErr  string
+	}{
+		{name: "HS256", header: map[string]string{"alg": "HS256"}, claims: valid(nil), signWith: "HS256"},
+		{name: "RS256", header: map[string]string{"alg": "RS256", "kid": "rsa"}, claims: valid(nil), signWith: "RS256"},
+		{name: "PS256", header: map[string]string{"alg": "PS256"}, claims: valid(nil), signWith: "PS256"},
+		{name: "ES256", header: map[string]string{"alg": "ES256", "kid": "ec"}, claims: valid(nil), signWith: "ES256"},
+		{name: "no exp", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"exp": nil}), signWith: "HS256"},
+		{name: "expired within the leeway", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}), signWith: "HS256"},
+
+		{name: "alg none", header: map[string]string{"alg": "none"}, claims: valid(nil), signWith: "none", wantErr: `unsupported token algorithm "none"`},
+		{name: "alg none with a signature", header: map[string]string{"alg": "none"}, claims: valid(nil), signWith: "HS256", wantErr: `unsupported token algorithm "none"`},
+		{name: "HS256 signed with the RSA public key", header: map[string]string{"alg": "HS256", "kid": "rsa"}, claims: valid(nil), signWith: "HS256-public-key", wantErr: "invalid token signature"},
+		{name: "RS256 header on an ECDSA signature", header: map[string]string{"alg": "RS256"}, claims: valid(nil), signWith: "ES256", wantErr: "invalid token signature"},
+		{name: "ES256 header on an RSA signature", header: map[string]string{"alg": "ES256"}, claims: valid(nil), signWith: "RS256", wantErr: "invalid token signature"},
+		{name: "PS256 header on a PKCS1 signature", header: map[string]string{"alg": "PS256"}, claims: valid(nil), signWith: "RS256", wantErr: "invalid token signature"},
+		{name: "key id of another key", header: map[string]string{"alg": "RS256", "kid": "ec"}, claims: valid(nil), signWith: "RS256", wantErr: "invalid token signature"},
+		{name: "expired", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), signWith: "HS256", wantErr: "token expired"},
+		{name: "not valid yet", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), signWith: "HS256", wantErr: "token not valid yet"},
+		{name: "unexpected issuer", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"iss": "https://evil.example.com"}), signWith: "HS256", wantErr: "unexpected token issuer"},
+		{name: "unexpected audience", header: map[string]string{"alg": "HS256"}, claims: valid(map[string]interface{}{"aud": "other"}), signWith: "HS256", wantErr: "unexpected token audience"},
+		{name: "malformed", token: "not-a-token", wantErr: "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = signer.sign(t, tt.header, tt.claims, tt.signWith)
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			claims, err := verifier.Claims(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Claims: %v", err)
+			}
+			if claims["sub"] != "user-1" {
+				t.Errorf("sub = %v, want user-1", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestJWTVerifierTamperedClaims(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier, err := NewJWTVerifier(JWTConfig{KeyClaim: "sub", HMACSecret: signer.secret})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	token := signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "user-1"}, "HS256")
+	forged := signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "admin"}, "none")
+	parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+	tampered := parts[0] + "." + forgedParts[1] + "." + parts[2]
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+tampered)
+	if _, err := verifier.Claims(r); err == nil || !strings.Contains(err.Error(), "invalid token signature") {
+		t.Fatalf("error = %v, want an invalid signature", err)
+	}
+}
+
+func TestJWTVerifierKeyFunc(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier, err := NewJWTVerifier(JWTConfig{KeyClaim: "sub", HMACSecret: signer.secret})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantKey       string
+		wantOK        bool
+	}{
+		{name: "no token", wantKey: "", wantOK: false},
+		{name: "other scheme", authorization: "Basic dXNlcjpwYXNz", wantKey: "", wantOK: false},
+		{name: "valid token", authorization: "Bearer " + signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "user-1"}, "HS256"), wantKey: "user-1", wantOK: true},
+		{name: "valid token without the claim", authorization: "Bearer " + signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"tier": "pro"}, "HS256"), wantKey: "", wantOK: false},
+		// Invalid tokens carry a key that cannot be trusted, so they are rejected instead of getting the default key
+		{name: "forged token", authorization: "Bearer " + signer.sign(t, map[string]string{"alg": "none"}, map[string]interface{}{"sub": "user-1"}, "none"), wantKey: "", wantOK: true},
+		{name: "malformed token", authorization: "Bearer abc", wantKey: "", wantOK: true},
+	}
+
+	keyFunc := verifier.KeyFunc()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			key, ok := keyFunc(r)
+			if key != tt.wantKey || ok != tt.wantOK {
+				t.Errorf("KeyFunc = %q, %v, want %q, %v", key, ok, tt.wantKey, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestJWTInvalidTokenIsRejected(t *testing.T) {
+	signer := newTestSigner(t)
+	verifier, err := NewJWTVerifier(JWTConfig{KeyClaim: "sub", HMACSecret: signer.secret})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	config := GetLocalRateLimiterDefaultConfig()
+	config.UniqueHeaderNameInRequest = ""
+	config.KeyFunc = verifier.KeyFunc()
+	config.DefaultKey = "anonymous"
+	rl, err := CreateLocalRateLimiter(config)
+	if err != nil {
+		t.Fatalf("CreateLocalRateLimiter: %v", err)
+	}
+	defer StopLocalRateLimiter(rl)
+	middleware, err := LocalMiddleware(rl, config)
+	if err != nil {
+		t.Fatalf("LocalMiddleware: %v", err)
+	}
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no token gets the default key", wantStatus: http.StatusOK},
+		{name: "valid token", authorization: "Bearer " + signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "user-1"}, "HS256"), wantStatus: http.StatusOK},
+		{name: "forged token", authorization: "Bearer " + signer.sign(t, map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "user-1"}, "HS256-public-key"), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package limiters
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// KeyFunc returns the key a request is rate limited by
+// All requests with the same key are considered as a single group of requests and are rate limited together.
+// It returns false when the request carries no key, and an empty key with true when the request carries a key
+// that is not valid, e.g. a bearer token with a bad signature - those requests are rejected with 401 instead of
+// falling back to the DefaultKey
+type KeyFunc func(r *http.Request) (string, bool)
+
+// HeaderKey keys requests by the value of a header
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		key := r.Header.Get(name)
+		return key, key != ""
+	}
+}
+
+// QueryKey keys requests by the value of a query parameter
+func QueryKey(param string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		key := r.URL.Query().Get(param)
+		return key, key != ""
+	}
+}
+
+// CookieKey keys requests by the value of a cookie
+func CookieKey(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", false
+		}
+		return cookie.Value, true
+	}
+}
+
+// PathSegmentKey keys requests by a segment of the path, counted from zero
+// e.g. index 1 of /tenants/acme/orders is "acme"
+func PathSegmentKey(index int) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if index < 0 || index >= len(segments) || segments[index] == "" {
+			return "", false
+		}
+		return segments[index], true
+	}
+}
+
+// MethodKey keys requests by their HTTP method
+func MethodKey() KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return r.Method, true
+	}
+}
+
+// RouteKey keys requests by their path
+func RouteKey() KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		return r.URL.Path, r.URL.Path != ""
+	}
+}
+
+// CompositeKey joins the keys of several extractors with "+", e.g. CompositeKey(ip, RouteKey()) for ip+route
+// A request missing any of the parts has no key, one with an invalid part has an invalid key
+func CompositeKey(parts ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		keys := make([]string, 0, len(parts))
+		for _, part := range parts {
+			key, ok := part(r)
+			if !ok || key == "" {
+				return "", ok
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "+"), true
+	}
+}
+
+// ClientIPKey keys requests by the IP address of the client
+// Without trusted proxies it is the address of the connection. When the connection comes from a
+// trusted proxy, the client is the right-most address of the Forwarded header - or X-Forwarded-For
+// when there is no Forwarded header - that is not a trusted proxy itself.
+// Trusted proxies are IP addresses or CIDR ranges
+func ClientIPKey(trustedProxies ...string) (KeyFunc, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, network := range trusted {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) (string, bool) {
+		remote := parseIP(r.RemoteAddr)
+		if remote == nil {
+			return "", false
+		}
+		if !isTrusted(remote) {
+			return remote.String(), true
+		}
+
+		// The connection comes from a trusted proxy - walk the chain from the closest hop
+		chain := forwardedFor(r.Header.Values("Forwarded"))
+		if len(chain) == 0 {
+			chain = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+		}
+		client := remote
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := parseIP(chain[i])
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !isTrusted(ip) {
+				break
+			}
+		}
+		return client.String(), true
+	}, nil
+}
+
+// parseIP parses an address with or without a port, IPv6 addresses can be in brackets
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// xForwardedFor returns the addresses of X-Forwarded-For headers, closest hop last
+func xForwardedFor(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, addr := range strings.Split(value, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	return chain
+}
+
+// forwardedFor returns the for= addresses of RFC 7239 Forwarded headers, closest hop last
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					chain = append(chain, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
@@ -0,0 +1,87 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// Limiter decides if a request of a key is allowed
+// Both rate limiters implement it, so code written against it runs on either backend and the middlewares
+// accept any Limiter. Allow takes cost tokens from the bucket of the key and returns the decision with the
+// state of the bucket - the context bounds the call, e.g. with the deadline of the request.
+// An error means no decision could be made, e.g. Redis is down, and the request should be rejected
+type Limiter interface {
+	Allow(ctx context.Context, key string, cost int) (Decision, error)
+}
+
+var (
+	_ Limiter = (*rate_limiter.LocalRateLimiter)(nil)
+	_ Limiter = (*rate_limiter.DistributedRateLimiter)(nil)
+)
+
+// newBackend binds the middlewares to the limiter
+// The rate limiters of this package support every setting. Any other Limiter decides on single requests
+// with its own limits, so the settings needing more than that return an error wrapping ErrInvalidConfig
+func newBackend(rl Limiter, settings middlewareSettings) (limiterBackend, error) {
+	switch rl := rl.(type) {
+	case nil:
+		return limiterBackend{}, invalidConfig(fmt.Errorf("limiter must not be nil"))
+	case *rate_limiter.LocalRateLimiter:
+		return localBackend(rl), nil
+	case *rate_limiter.DistributedRateLimiter:
+		if settings.concurrency.enabled() && settings.concurrency.LeaseTime < minLeaseTime {
+			return limiterBackend{}, invalidConfig(fmt.Errorf("Concurrency.LeaseTime must be at least %v, got %v", minLeaseTime, settings.concurrency.LeaseTime))
+		}
+		return distributedBackend(rl, settings.concurrency.LeaseTime), nil
+	}
+
+	switch {
+	case len(settings.rules) > 0 || settings.hierarchy.enabled() || settings.global.Enabled || len(settings.routes) > 0:
+		return limiterBackend{}, invalidConfig(fmt.Errorf("rules, hierarchies, the global limit and routes need a rate limiter of this package"))
+	case settings.resolver != nil || settings.apiKeys != nil:
+		return limiterBackend{}, invalidConfig(fmt.Errorf("resolvers and API keys need a rate limiter of this package"))
+	case settings.concurrency.enabled():
+		return limiterBackend{}, invalidConfig(fmt.Errorf("concurrency limits need a rate limiter of this package"))
+	case settings.adaptive.Enabled:
+		return limiterBackend{}, invalidConfig(fmt.Errorf("adaptive mode needs a rate limiter of this package"))
+	}
+
+	return limiterBackend{
+		allowWithAlgorithm: func(ctx context.Context, id string, tokens int, _ int, _ float64, _ rate_limiter.AlgorithmConfig) (Decision, error) {
+			return rl.Allow(ctx, id, tokens)
+		},
+	}, nil
+}
+
+// pinger is implemented by the limiters backed by a remote store, like the distributed rate limiter
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ping checks that a limiter backed by a remote store can reach it
+// Limiters without a Ping method, like the local rate limiter, are always reachable
+func ping(rl Limiter) error {
+	remote, ok := rl.(pinger)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return remote.Ping(ctx)
+}
+
+// bindLimiter binds a new middleware to the limiter once it can reach its store
+func bindLimiter(rl Limiter, settings middlewareSettings) (limiterBackend, error) {
+	backend, err := newBackend(rl, settings)
+	if err != nil {
+		return limiterBackend{}, err
+	}
+	if err := ping(rl); err != nil {
+		return limiterBackend{}, err
+	}
+	return backend, nil
+}
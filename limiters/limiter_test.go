@@ -0,0 +1,43 @@
+package limiters
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+func TestNewBackendLeaseTime(t *testing.T) {
+	server := miniredis.RunT(t)
+	rl, err := rate_limiter.NewDistributedRateLimiter(server.Addr(), "", 0, "test", time.Minute, time.Minute, rate_limiter.AlgorithmConfig{}, rate_limiter.Limits{})
+	if err != nil {
+		t.Fatalf("NewDistributedRateLimiter: %v", err)
+	}
+	defer rl.Stop()
+
+	tests := []struct {
+		name      string
+		leaseTime time.Duration
+		wantErr   bool
+	}{
+		{name: "no lease time", leaseTime: 0, wantErr: true},
+		{name: "nanosecond", leaseTime: time.Nanosecond, wantErr: true},
+		{name: "below the minimum", leaseTime: 99 * time.Millisecond, wantErr: true},
+		{name: "minimum", leaseTime: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := middlewareSettings{concurrency: ConcurrencyConfig{MaxInFlight: 1, LeaseTime: tt.leaseTime}}
+			_, err := newBackend(rl, settings)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("newBackend error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package limiters
 
 import (
-	"log"
+	"fmt"
 	"time"
 
 	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
@@ -9,13 +9,32 @@ import (
 
 // RateLimiterConfig holds configuration for both implementations
 type LocalRateLimiterConfig struct {
-	Capacity                  int           // Total number of tokens in the bucket
-	RefillRate                int           // Number of tokens to add per second
-	TargetURL                 string        // Target URL for reverse proxy - to be used in the middleware
-	UniqueHeaderNameInRequest string        // Unique header name in the request
-	MaxEntries                int           // Maximum number of entries in the cache
-	CleanupInterval           time.Duration // Cleanup interval for the cache,
-	ExpirationTime            time.Duration // Cleanup interval and expiration time for the cache
+	Capacity                  int               // Total number of tokens in the bucket
+	RefillRate                float64           // Number of tokens to add per second - fractions allowed, e.g. 1.0/60 for one token per minute
+	TargetURL                 string            // Target URL for reverse proxy - to be used in the middleware
+	UniqueHeaderNameInRequest string            // Unique header name in the request
+	MaxEntries                int               // Maximum number of entries in the cache
+	CleanupInterval           time.Duration     // Cleanup interval for the cache,
+	ExpirationTime            time.Duration     // Cleanup interval and expiration time for the cache
+	Algorithm                 Algorithm         // Rate limiting algorithm - TokenBucket, SlidingWindowLog, SlidingWindowCounter or FixedWindow
+	Window                    time.Duration     // Window length for the window based algorithms - Capacity requests are allowed per window
+	WindowUnit                WindowUnit        // Calendar unit the FixedWindow windows align to (minute, hour, day, month) - overrides Window
+	Location                  *time.Location    // Time zone of the calendar windows - defaults to UTC
+	Queue                     QueueConfig       // Queueing mode - hold requests until they can be allowed instead of rejecting them
+	Concurrency               ConcurrencyConfig // In-flight request limits per key and across all keys
+	Adaptive                  AdaptiveConfig    // Adaptive mode - lower the refill rate while the target is unhealthy
+	Cost                      CostFunc          // Tokens a request costs - one token per request when nil
+	Resolver                  LimitResolver     // Capacity, refill rate and cost per key - every key gets Capacity and RefillRate when nil
+	KeyFunc                   KeyFunc           // Extracts the key of a request - the UniqueHeaderNameInRequest header when nil
+	DefaultKey                string            // Key of the requests without one - they are rejected with 400 when empty
+	APIKeys                   *APIKeyStore      // Known API keys with their own limits and daily quotas - any key is accepted when nil
+	Rules                     []Rule            // Limits every key is held to at once, e.g. per second, hour and day - replace Capacity and RefillRate when set
+	Hierarchy                 HierarchyConfig   // Parent level above the key of every request, e.g. an organisation ceiling above its users
+	Global                    GlobalConfig      // Bucket shared by all the requests on top of the bucket of each key
+	Routes                    []Route           // Routes with their own limits, key and cost, matched in order - the config is the default route
+	Headers                   HeadersConfig     // Rate limit headers of the responses - RateLimit-* by default, X-RateLimit-* with Legacy
+	Rejection                 RejectionConfig   // Responses of the rejected requests - plain text 429 by default, JSON or problem details
+	Namespace                 string            // Prefix of the buckets - lets several middlewares share one rate limiter with their own buckets
 }
 
 // GetLocalRateLimiterDefaultConfig returns the default configuration for the local rate limiter
@@ -28,19 +47,44 @@ func GetLocalRateLimiterDefaultConfig() LocalRateLimiterConfig {
 		MaxEntries:                1000,
 		CleanupInterval:           1 * time.Minute,
 		ExpirationTime:            5 * time.Minute,
+		Algorithm:                 TokenBucket,
+		Window:                    1 * time.Minute,
+		Queue: QueueConfig{
+			Enabled:       false,
+			MaxQueueDepth: 100,
+			MaxWait:       5 * time.Second,
+		},
+		Adaptive: AdaptiveConfig{
+			Enabled:        false,
+			MinRefillRate:  0.1,
+			DecreaseFactor: 0.5,
+			IncreaseStep:   0.1,
+		},
 	}
 }
 
 // LocalNewRateLimiter creates the appropriate rate limiter based on the configuration
+// It implements Limiter - Allow checks every key against the Capacity and RefillRate of the config.
+// An invalid config returns an error wrapping ErrInvalidConfig
 func CreateLocalRateLimiter(config LocalRateLimiterConfig) (*rate_limiter.LocalRateLimiter, error) {
 	// Initialize the local rate limiter
 	rateLimiter, err := rate_limiter.NewLocalRateLimiter(
 		config.MaxEntries,
 		config.CleanupInterval,
 		config.ExpirationTime,
+		rate_limiter.AlgorithmConfig{
+			Algorithm:  config.Algorithm,
+			Window:     config.Window,
+			WindowUnit: config.WindowUnit,
+			Location:   config.Location,
+		},
+		rate_limiter.Limits{
+			Capacity:   config.Capacity,
+			RefillRate: config.RefillRate,
+		},
 	)
 	if err != nil {
-		log.Fatalf("Failed to initialize local rate limiter: %v", err)
+		return nil, invalidConfig(fmt.Errorf("failed to initialize local rate limiter: %w", err))
 	}
 
 	return rateLimiter, nil
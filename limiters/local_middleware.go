@@ -1,9 +1,11 @@
 package limiters
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
-	"github.com/krishpatel023/ratelimiter/internal/helper"
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
 	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
 )
 
@@ -12,48 +14,97 @@ import (
 // the allowed requests. Based on the response will either decline or forward the request.
 // It is also responsible for the reverse proxy setup and the forwarding of the request if the
 // request is allowed
+// Any Limiter can be used, e.g. the distributed rate limiter with the local config.
+// An invalid config returns an error wrapping ErrInvalidTargetURL, ErrMissingKeyHeader or ErrInvalidConfig,
+// and ErrBackendUnavailable is returned when the limiter cannot reach its store
 
-func LocalRateLimitingMiddleware(rl *rate_limiter.LocalRateLimiter, config LocalRateLimiterConfig) http.Handler {
+func LocalRateLimitingMiddleware(rl Limiter, config LocalRateLimiterConfig) (http.Handler, error) {
 
 	// Create a reverse proxy
-	handler := reverseProxy(config.TargetURL)
-	if handler == nil {
-		return nil
+	handler, err := reverseProxy(config.TargetURL)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check unique header name in request
-	if config.UniqueHeaderNameInRequest == "" {
-		helper.Log("Request rejected: Set UniqueHeaderNameInRequest header in config", "warning")
-		return nil
+	settings, err := config.middlewareSettings()
+	if err != nil {
+		return nil, err
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-		// Check if the X-ID header is present
-		// RequestID is used to identify the request group - all requests with the same X-ID header
-		// are considered as a single group of requests and are rate limited together
-		requestID := r.Header.Get(config.UniqueHeaderNameInRequest)
-		if requestID == "" {
-			http.Error(w, "Missing UniqueHeaderNameInRequest header", http.StatusBadRequest)
-			helper.Log("Request rejected: Missing UniqueHeaderNameInRequest header", "warning")
-			return
-		}
+	backend, err := bindLimiter(rl, settings)
+	if err != nil {
+		return nil, err
+	}
 
-		// Can add a function to get dynamic rate limit config
-		// token_per_req, total_token, refill_rate := getRateLimiterConfig(requestID)
+	return rateLimitHandler(backend, settings, handler), nil
+}
 
-		// Get rate limit config
-		token_per_req, total_token, refill_rate := 1, config.Capacity, config.RefillRate
+// middlewareSettings builds the request handling settings from the local config
+// The errors wrap ErrMissingKeyHeader or ErrInvalidConfig
+func (config LocalRateLimiterConfig) middlewareSettings() (middlewareSettings, error) {
+	settings, err := config.settings()
+	return settings, invalidConfig(err)
+}
 
-		// Check if the request is allowed
-		allowed := rl.AllowRequest(requestID, token_per_req, total_token, refill_rate)
-		if !allowed {
-			http.Error(w, "Too many requests", http.StatusTooManyRequests)
-			helper.Log("Request blocked - RequestID: "+requestID, "warning")
-			return
+// settings validates the local config and builds its settings
+func (config LocalRateLimiterConfig) settings() (middlewareSettings, error) {
+	if config.Algorithm == GCRA {
+		return middlewareSettings{}, fmt.Errorf("algorithm %q is only supported by the distributed rate limiter", GCRA)
+	}
+	for _, rule := range append([]Rule{config.Hierarchy.Parent}, config.Rules...) {
+		if rule.Algorithm == GCRA {
+			return middlewareSettings{}, fmt.Errorf("rule %q: algorithm %q is only supported by the distributed rate limiter", rule.Name, GCRA)
 		}
+	}
+	for _, route := range config.Routes {
+		if route.Algorithm == GCRA {
+			return middlewareSettings{}, fmt.Errorf("route %q: algorithm %q is only supported by the distributed rate limiter", route.Name, GCRA)
+		}
+	}
 
-		helper.Log("Request allowed - RequestID: "+requestID, "info")
-		handler.ServeHTTP(w, r)
-	})
+	return middlewareSettings{
+		headerName:  config.UniqueHeaderNameInRequest,
+		capacity:    config.Capacity,
+		refillRate:  config.RefillRate,
+		algorithm:   config.Algorithm,
+		window:      config.Window,
+		windowUnit:  config.WindowUnit,
+		location:    config.Location,
+		queueConfig: config.Queue,
+		concurrency: config.Concurrency,
+		adaptive:    config.Adaptive,
+		cost:        config.Cost,
+		resolver:    config.Resolver,
+		keyFunc:     config.KeyFunc,
+		defaultKey:  config.DefaultKey,
+		apiKeys:     config.APIKeys,
+		rules:       config.Rules,
+		hierarchy:   config.Hierarchy,
+		global:      config.Global,
+		routeConfig: config.Routes,
+		headers:     config.Headers,
+		rejection:   config.Rejection,
+		namespace:   config.Namespace,
+	}.build()
+}
+
+// localBackend binds the middlewares to the local rate limiter
+// The buckets are in memory, so the context is not needed
+func localBackend(rl *rate_limiter.LocalRateLimiter) limiterBackend {
+	return limiterBackend{
+		allowWithAlgorithm: func(_ context.Context, id string, tokens int, capacity int, refillRate float64, algorithm rate_limiter.AlgorithmConfig) (rate_limiter.Result, error) {
+			return rl.AllowRequestWithAlgorithm(id, tokens, capacity, refillRate, algorithm), nil
+		},
+		allowLevels: func(_ context.Context, levels []rate_limiter.Level, tokens int) (rate_limiter.Result, int, error) {
+			result, rejected := rl.AllowRequestLevels(levels, tokens)
+			return result, rejected, nil
+		},
+		acquire: func(_ context.Context, id string, perKey, global int) (func(), bool, error) {
+			release, ok := rl.AcquireSlot(id, perKey, global)
+			return release, ok, nil
+		},
+		adjust: func(_ context.Context, tally adaptive.Tally, settings adaptive.Settings) (float64, error) {
+			return rl.AdjustRefillRate(tally, settings), nil
+		},
+	}
 }
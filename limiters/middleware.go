@@ -0,0 +1,647 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/adaptive"
+	"github.com/krishpatel023/ratelimiter/internal/helper"
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// allowWithAlgorithmFunc checks a request group against a bucket running the given algorithm
+// It is satisfied by the AllowRequestWithAlgorithm method of the distributed rate limiter
+type allowWithAlgorithmFunc func(ctx context.Context, id string, tokens int, capacity int, refillRate float64, algorithm rate_limiter.AlgorithmConfig) (rate_limiter.Result, error)
+
+// limiterBackend holds the rate limiter operations used by the middlewares
+// The operations a Limiter does not support are nil - see newBackend
+type limiterBackend struct {
+	allowWithAlgorithm allowWithAlgorithmFunc
+	allowLevels        allowLevelsFunc
+	acquire            acquireFunc
+	adjust             adjustFunc
+}
+
+// namespaced prefixes the ids of all the buckets and in-flight slots with the namespace - see joinKeys
+// Every id gets the prefix, even without a namespace, so the key api:x of a middleware without a namespace
+// does not share a bucket with the key x of the namespace api.
+// The adaptive refill rate stays shared by everything using the rate limiter
+func (backend limiterBackend) namespaced(namespace string) limiterBackend {
+	namespaced := limiterBackend{
+		allowWithAlgorithm: func(ctx context.Context, id string, tokens int, capacity int, refillRate float64, algorithm rate_limiter.AlgorithmConfig) (rate_limiter.Result, error) {
+			return backend.allowWithAlgorithm(ctx, joinKeys(namespace, id), tokens, capacity, refillRate, algorithm)
+		},
+		adjust: backend.adjust,
+	}
+	if backend.allowLevels != nil {
+		namespaced.allowLevels = func(ctx context.Context, levels []rate_limiter.Level, tokens int) (rate_limiter.Result, int, error) {
+			prefixed := make([]rate_limiter.Level, len(levels))
+			for i, level := range levels {
+				prefixed[i] = rate_limiter.Level{ID: joinKeys(namespace, level.ID), Rule: level.Rule}
+			}
+			return backend.allowLevels(ctx, prefixed, tokens)
+		}
+	}
+	if backend.acquire != nil {
+		namespaced.acquire = func(ctx context.Context, id string, perKey, global int) (func(), bool, error) {
+			return backend.acquire(ctx, joinKeys(namespace, id), perKey, global)
+		}
+	}
+	return namespaced
+}
+
+// middlewareSettings holds the parts of the local and distributed configs used while handling requests
+type middlewareSettings struct {
+	headerName  string            // Header identifying the request group - used when keyFunc is nil
+	keyFunc     KeyFunc           // Extracts the key of a request
+	defaultKey  string            // Key of the requests without one - they are rejected when empty
+	capacity    int               // Capacity of each bucket
+	refillRate  float64           // Refill rate of each bucket
+	algorithm   Algorithm         // Algorithm of the rate limiter
+	window      time.Duration     // Window of the window based algorithms
+	windowUnit  WindowUnit        // Calendar unit of the FixedWindow windows
+	location    *time.Location    // Time zone of the calendar windows
+	queueConfig QueueConfig       // Settings of the queueing mode
+	concurrency ConcurrencyConfig // In-flight request limits
+	adaptive    AdaptiveConfig    // Settings of the adaptive mode
+	cost        CostFunc          // Tokens a request costs - one per request when nil
+	resolver    LimitResolver     // Limit of each key - every key gets capacity and refillRate when nil
+	apiKeys     *APIKeyStore      // Known API keys - any key is accepted when nil
+	rules       []Rule            // Limits every key is held to at once - replace capacity and refillRate when set
+	hierarchy   HierarchyConfig   // Parent level above the key of every request
+	global      GlobalConfig      // Bucket shared by all the requests
+	routeConfig []Route           // Routes with their own limits, matched in order
+	headers     HeadersConfig     // Rate limit headers of the responses
+	rejection   RejectionConfig   // Responses of the rejected requests
+	namespace   string            // Prefix of the buckets of the middleware - keeps middlewares sharing a rate limiter apart
+
+	routes []compiledRoute // Routes ready for matching
+	queue  *requestQueue   // Queue of the waiting requests - nil when the queueing mode is disabled
+	rate   *adaptiveRate   // Current adaptive refill rate - nil when the adaptive mode is disabled
+	health *healthTally    // Responses not yet applied to the adaptive refill rate - nil when it is disabled
+}
+
+// build validates the settings and sets up the state shared by all the requests
+func (settings middlewareSettings) build() (middlewareSettings, error) {
+	// The header only identifies requests when no KeyFunc is set
+	if settings.keyFunc == nil {
+		if settings.headerName == "" {
+			return settings, ErrMissingKeyHeader
+		}
+		settings.keyFunc = HeaderKey(settings.headerName)
+	} else {
+		settings.headerName = ""
+	}
+
+	if settings.refillRate < 0 {
+		return settings, fmt.Errorf("RefillRate must not be negative, got %v", settings.refillRate)
+	}
+	if len(settings.rules) == 0 && settings.capacity <= 0 {
+		return settings, fmt.Errorf("capacity must be greater than zero, got %d", settings.capacity)
+	}
+
+	// Rules take the place of the single limit of the config
+	if len(settings.rules) > 0 {
+		if err := rate_limiter.ValidateRules(settings.rules); err != nil {
+			return settings, fmt.Errorf("rules: %w", err)
+		}
+		if settings.resolver != nil {
+			return settings, fmt.Errorf("rules cannot be combined with a Resolver")
+		}
+		if settings.adaptive.Enabled {
+			return settings, fmt.Errorf("rules cannot be combined with the adaptive mode")
+		}
+		settings.capacity = rulesCapacity(settings.rules)
+	}
+
+	if settings.hierarchy.enabled() {
+		if err := settings.hierarchy.validate(settings.rules); err != nil {
+			return settings, err
+		}
+	}
+
+	if settings.global.Enabled {
+		if err := settings.global.validate(); err != nil {
+			return settings, err
+		}
+	}
+
+	if err := settings.rejection.validate(); err != nil {
+		return settings, err
+	}
+
+	routes, err := compileRoutes(settings.routeConfig)
+	if err != nil {
+		return settings, err
+	}
+	settings.routes = routes
+
+	// The API keys set the limit of each key unless a resolver or rules are given
+	// With rules the limit of a key is checked as one more level next to them - see levels
+	if settings.apiKeys != nil && settings.resolver == nil && len(settings.rules) == 0 {
+		settings.resolver = settings.apiKeys.resolver(settings.capacity, settings.refillRate)
+	}
+	if settings.apiKeys != nil {
+		for _, rule := range settings.rules {
+			if rule.Name == apiKeyLevelName || rule.Name == quotaLevelName {
+				return settings, fmt.Errorf("rule name %q is reserved for the API keys", rule.Name)
+			}
+		}
+	}
+
+	if settings.queueConfig.Enabled {
+		if settings.queueConfig.MaxQueueDepth <= 0 {
+			return settings, fmt.Errorf("Queue.MaxQueueDepth must be greater than zero")
+		}
+		if settings.queueConfig.MaxWait <= 0 {
+			return settings, fmt.Errorf("Queue.MaxWait must be greater than zero")
+		}
+		interval := queueRetryInterval(settings.algorithm, settings.capacity, settings.refillRate, settings.window)
+		if len(settings.rules) > 0 {
+			interval = rulesRetryInterval(settings.rules)
+		}
+		settings.queue = newRequestQueue(settings.queueConfig, interval)
+	}
+
+	if settings.concurrency.MaxInFlightPerKey < 0 || settings.concurrency.MaxInFlight < 0 {
+		return settings, fmt.Errorf("concurrency limits must not be negative")
+	}
+
+	if settings.adaptive.Enabled {
+		switch {
+		case settings.algorithm != "" && settings.algorithm != TokenBucket && settings.algorithm != GCRA:
+			return settings, fmt.Errorf("adaptive mode requires the TokenBucket or GCRA algorithm")
+		case settings.adaptive.MinRefillRate <= 0 || settings.adaptive.MinRefillRate > settings.refillRate:
+			return settings, fmt.Errorf("Adaptive.MinRefillRate must be greater than zero and at most RefillRate")
+		case settings.adaptive.DecreaseFactor <= 0 || settings.adaptive.DecreaseFactor >= 1:
+			return settings, fmt.Errorf("Adaptive.DecreaseFactor must be between 0 and 1")
+		case settings.adaptive.IncreaseStep <= 0:
+			return settings, fmt.Errorf("Adaptive.IncreaseStep must be greater than zero")
+		}
+		settings.rate = newAdaptiveRate(settings.refillRate)
+		settings.health = &healthTally{}
+	}
+
+	return settings, nil
+}
+
+// queueRetryInterval estimates how long a bucket takes to free up room for one more request
+// It is how often the request at the head of a queue retries, kept between 10ms and 1s
+func queueRetryInterval(algorithm Algorithm, capacity int, refillRate float64, window time.Duration) time.Duration {
+	interval := time.Second
+	switch algorithm {
+	case SlidingWindowLog, SlidingWindowCounter, FixedWindow:
+		if capacity > 0 && window > 0 {
+			interval = window / time.Duration(capacity)
+		}
+	default:
+		if refillRate > 0 {
+			interval = time.Duration(float64(time.Second) / refillRate)
+		}
+	}
+	return min(max(interval, 10*time.Millisecond), time.Second)
+}
+
+// rateLimitHandler checks every request against the rate limiter and hands the allowed ones to next
+func rateLimitHandler(backend limiterBackend, settings middlewareSettings, next http.Handler) http.Handler {
+	backend = backend.namespaced(settings.namespace)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// The route of the request sets its limits - the config does for requests matching no route
+		route := settings.matchRoute(r)
+		keyFunc, cost := settings.keyFunc, settings.cost
+		if route != nil && route.KeyFunc != nil {
+			keyFunc = route.KeyFunc
+		}
+		if route != nil && route.Cost != nil {
+			cost = route.Cost
+		}
+
+		// RequestID is used to identify the request group - all requests with the same key
+		// are considered as a single group of requests and are rate limited together
+		requestID, ok := keyFunc(r)
+		if ok && requestID == "" {
+			// The request carries a key that failed verification, e.g. a forged token - it never gets the default key
+			settings.rejection.reject(w, r, Rejection{
+				Reason:  ReasonInvalidKey,
+				Status:  http.StatusUnauthorized,
+				Message: "Invalid " + settings.missingKeyName(route),
+			})
+			helper.Log("Request rejected: Invalid "+settings.missingKeyName(route), "warning")
+			return
+		}
+		if !ok {
+			requestID = settings.defaultKey
+		}
+		if requestID == "" {
+			status := http.StatusBadRequest
+			if settings.apiKeys != nil {
+				status = http.StatusUnauthorized
+			}
+			settings.rejection.reject(w, r, Rejection{
+				Reason:  ReasonMissingKey,
+				Status:  status,
+				Message: "Missing " + settings.missingKeyName(route),
+			})
+			helper.Log("Request rejected: Missing "+settings.missingKeyName(route), "warning")
+			return
+		}
+
+		// API keys are secrets, so only a hash of them is logged or sent back in a rejection
+		displayKey := requestID
+		if settings.apiKeys != nil {
+			displayKey = redactKey(requestID)
+		}
+
+		// Only known and enabled API keys get through when the config has an API key store
+		var apiKey APIKey
+		if settings.apiKeys != nil {
+			apiKey, ok = settings.apiKeys.Lookup(requestID)
+			if !ok {
+				settings.rejection.reject(w, r, Rejection{
+					Reason:  ReasonUnknownAPIKey,
+					Status:  http.StatusUnauthorized,
+					Message: "Unknown API key",
+				})
+				helper.Log("Request rejected: Unknown API key - RequestID: "+displayKey, "warning")
+				return
+			}
+			if !apiKey.Enabled {
+				settings.rejection.reject(w, r, Rejection{
+					Reason:  ReasonAPIKeyDisabled,
+					Status:  http.StatusForbidden,
+					Message: "API key disabled",
+					Key:     displayKey,
+				})
+				helper.Log("Request rejected: API key disabled - RequestID: "+displayKey, "warning")
+				return
+			}
+		}
+
+		// The parent key of the request, e.g. its organisation, when the config has a hierarchy
+		var parentID string
+		if settings.hierarchy.enabled() {
+			parentID, ok = settings.hierarchy.ParentKeyFunc(r)
+			if ok && parentID == "" {
+				settings.rejection.reject(w, r, Rejection{
+					Reason:  ReasonInvalidKey,
+					Status:  http.StatusUnauthorized,
+					Message: "Invalid parent key",
+					Key:     displayKey,
+				})
+				helper.Log("Request rejected: Invalid parent key - RequestID: "+displayKey, "warning")
+				return
+			}
+			if !ok || parentID == "" {
+				settings.rejection.reject(w, r, Rejection{
+					Reason:  ReasonMissingParentKey,
+					Status:  http.StatusBadRequest,
+					Message: "Missing parent key",
+					Key:     displayKey,
+				})
+				helper.Log("Request rejected: Missing parent key - RequestID: "+displayKey, "warning")
+				return
+			}
+		}
+
+		// Unlimited routes skip the buckets, but only once the key of the request is known to be valid
+		if route != nil && route.Unlimited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Get rate limit config
+		token_per_req, total_token, refill_rate := 1, settings.capacity, settings.refillRate
+		if route != nil {
+			total_token, refill_rate = route.Capacity, route.RefillRate
+		}
+		if cost != nil {
+			token_per_req = max(cost(r), 0)
+		}
+
+		// Get the limit of this key - falls back to the config if the resolver fails
+		// The limits of a route are the same for every key
+		if settings.resolver != nil && route == nil {
+			limit, err := settings.resolver.ResolveLimit(requestID, r)
+			if err != nil {
+				helper.Log("Failed to resolve the limit of RequestID: "+displayKey+" - "+err.Error(), "error")
+			} else {
+				total_token, refill_rate = limit.Capacity, limit.RefillRate
+				if limit.Cost > 0 {
+					token_per_req = limit.Cost
+				}
+			}
+		}
+
+		// Adaptive mode scales the refill rate down by as much as the target needs
+		if settings.rate != nil {
+			refill_rate *= settings.rate.load() / settings.refillRate
+		}
+
+		// A request costing more than the whole bucket can never be allowed
+		if rule, exceeded := settings.exceededLevel(token_per_req, total_token, route); exceeded {
+			settings.rejection.reject(w, r, Rejection{
+				Reason:  ReasonCostExceedsCapacity,
+				Status:  settings.rejection.limitedStatus(rule),
+				Message: "Too many requests",
+				Key:     displayKey,
+				Rule:    rule,
+			})
+			helper.Log("Request blocked - cost "+strconv.Itoa(token_per_req)+" exceeds capacity - RequestID: "+displayKey, "warning")
+			return
+		}
+
+		// Rules, hierarchies, the global bucket and the daily quota check all the buckets of the request at once
+		// and report the level that rejected the request - a rejected request takes nothing from any of them
+		levels := settings.levels(requestID, parentID, total_token, refill_rate, route, apiKey)
+		var rejectedLevel string
+		var quotaPolicy string
+		if levels == nil {
+			quotaPolicy = policy(Rule{
+				Capacity:   total_token,
+				RefillRate: refill_rate,
+				Algorithm:  settings.algorithm,
+				Window:     settings.window,
+				WindowUnit: settings.windowUnit,
+				Location:   settings.location,
+			})
+		} else {
+			quotaPolicy = levelsPolicy(levels)
+		}
+
+		// The decision is kept for the rate limit headers - a request turned away by a full queue keeps the limit only
+		// The in-flight slot is taken before the buckets and given back if they reject the request,
+		// so a request turned away for concurrency takes no tokens.
+		// Errors of the rate limiter, e.g. Redis being down or the request being cancelled, reject the request
+		// with 503 instead of the rate limited response, as no bucket made a decision
+		result := rate_limiter.Result{Limit: total_token}
+		var release func()
+		var backendErr error
+		check := func() bool {
+			rejectedLevel = ""
+			backendErr = nil
+			if settings.concurrency.enabled() {
+				var ok bool
+				release, ok, backendErr = backend.acquire(r.Context(), requestID, settings.concurrency.MaxInFlightPerKey, settings.concurrency.MaxInFlight)
+				if backendErr != nil {
+					helper.Log("Rate limiter error - RequestID: "+displayKey+" - "+backendErr.Error(), "error")
+					return false
+				}
+				if !ok {
+					rejectedLevel = concurrencyLevelName
+					return false
+				}
+			}
+
+			if levels == nil {
+				result, backendErr = backend.allowWithAlgorithm(r.Context(), requestID, token_per_req, total_token, refill_rate, settings.algorithmConfig())
+				rejectedLevel = keyLevelName
+			} else {
+				var rejected int
+				result, rejected, backendErr = backend.allowLevels(r.Context(), levels, token_per_req)
+				if !result.Allowed && rejected >= 0 {
+					rejectedLevel = levels[rejected].Rule.Name
+				}
+			}
+			if backendErr != nil {
+				helper.Log("Rate limiter error - RequestID: "+displayKey+" - "+backendErr.Error(), "error")
+			}
+			if backendErr != nil || !result.Allowed {
+				if release != nil {
+					release()
+					release = nil
+				}
+				return false
+			}
+			return true
+		}
+
+		// Check if the request is allowed
+		// In queueing mode the request is held until the bucket can take it
+		var allowed bool
+		if settings.queue != nil {
+			queueID := requestID
+			if route != nil {
+				queueID = "route:" + route.Name + ":" + requestID
+			}
+			allowed = settings.queue.wait(r.Context(), queueID, check)
+		} else {
+			allowed = check()
+		}
+		if !allowed && backendErr != nil {
+			// No decision was made, so no rate limit headers are sent
+			settings.rejection.reject(w, r, Rejection{
+				Reason:  ReasonBackendUnavailable,
+				Status:  http.StatusServiceUnavailable,
+				Message: "Rate limiter unavailable",
+				Key:     displayKey,
+			})
+			return
+		}
+		if !allowed && rejectedLevel == concurrencyLevelName {
+			// No bucket was checked, so only Retry-After is sent
+			writeRetryAfter(w.Header(), 0)
+			settings.rejection.reject(w, r, Rejection{
+				Reason:  ReasonTooManyConcurrent,
+				Status:  settings.rejection.limitedStatus(concurrencyLevelName),
+				Message: "Too many concurrent requests",
+				Key:     displayKey,
+				Rule:    concurrencyLevelName,
+			})
+			helper.Log("Request blocked - too many concurrent requests - RequestID: "+displayKey, "warning")
+			return
+		}
+		if !allowed && rejectedLevel == quotaLevelName {
+			settings.headers.write(w.Header(), result, quotaPolicy)
+			writeRetryAfter(w.Header(), result.RetryAfter)
+			settings.rejection.reject(w, r, Rejection{
+				Reason:   ReasonQuotaExceeded,
+				Status:   settings.rejection.limitedStatus(quotaLevelName),
+				Message:  "Daily quota exceeded",
+				Key:      displayKey,
+				Rule:     quotaLevelName,
+				Decision: &result,
+			})
+			helper.Log("Request blocked - daily quota exceeded - RequestID: "+displayKey, "warning")
+			return
+		}
+		if !allowed {
+			settings.headers.write(w.Header(), result, quotaPolicy)
+			writeRetryAfter(w.Header(), result.RetryAfter)
+			rejection := Rejection{
+				Reason:   ReasonRateLimited,
+				Status:   settings.rejection.limitedStatus(rejectedLevel),
+				Message:  "Too many requests",
+				Key:      displayKey,
+				Rule:     rejectedLevel,
+				Decision: &result,
+			}
+			if (settings.hierarchy.enabled() || settings.global.Enabled) && rejectedLevel != "" {
+				rejection.Message = "Too many requests - " + rejectedLevel + " limit reached"
+				settings.rejection.reject(w, r, rejection)
+				if settings.hierarchy.enabled() {
+					helper.Log("Request blocked - "+rejectedLevel+" limit reached - RequestID: "+displayKey+" - Parent: "+parentID, "warning")
+				} else {
+					helper.Log("Request blocked - "+rejectedLevel+" limit reached - RequestID: "+displayKey, "warning")
+				}
+				return
+			}
+			settings.rejection.reject(w, r, rejection)
+			helper.Log("Request blocked - RequestID: "+displayKey, "warning")
+			return
+		}
+
+		// The slot is held until the handler returns
+		if release != nil {
+			defer release()
+		}
+
+		helper.Log("Request allowed - RequestID: "+displayKey, "info")
+		settings.headers.write(w.Header(), result, quotaPolicy)
+		if settings.rate == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Adaptive mode - adjust the refill rate to the status and latency of the response
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		healthy := settings.adaptive.healthy(recorder.status, time.Since(start))
+		tally, full := settings.health.record(healthy, time.Now())
+		if !full {
+			return
+		}
+
+		rate, err := backend.adjust(r.Context(), tally, settings.adaptiveSettings())
+		if err != nil {
+			helper.Log("Failed to adjust the adaptive refill rate: "+err.Error(), "error")
+			return
+		}
+		settings.rate.store(rate)
+	})
+}
+
+// levels returns the buckets a request draws from when the config has rules, a hierarchy or a global bucket,
+// the request matched a route or its API key has a daily quota, nil when the request is held to the single
+// limit of the config. The shared buckets come first - the global bucket, then the parent - followed by the
+// limit of the route, the rules of the key or its own limit, and the daily quota last
+func (settings middlewareSettings) levels(requestID, parentID string, capacity int, refillRate float64, route *compiledRoute, apiKey APIKey) []rate_limiter.Level {
+	if len(settings.rules) == 0 && !settings.hierarchy.enabled() && !settings.global.Enabled && route == nil && apiKey.DailyQuota == 0 {
+		return nil
+	}
+
+	// The daily quota of the API key is counted in a fixed window of a calendar day in UTC
+	// It belongs to the key itself, whatever its parent
+	var quotaLevels []rate_limiter.Level
+	if apiKey.DailyQuota > 0 {
+		quotaLevels = []rate_limiter.Level{{
+			ID:   "quota:" + requestID,
+			Rule: Rule{Name: quotaLevelName, Capacity: apiKey.DailyQuota, Algorithm: FixedWindow, WindowUnit: WindowDay},
+		}}
+	}
+
+	// The key gets its own buckets under every parent, so the same key under two parents is counted twice
+	var levels []rate_limiter.Level
+	if settings.global.Enabled {
+		levels = append(levels, settings.global.level())
+	}
+	if settings.hierarchy.enabled() {
+		levels = append(levels, rate_limiter.Level{ID: parentID, Rule: settings.hierarchy.Parent})
+		requestID = joinKeys(parentID, requestID)
+	}
+
+	if route != nil {
+		levels = append(levels, rate_limiter.Level{ID: requestID, Rule: route.rule(capacity, refillRate)})
+		return append(levels, quotaLevels...)
+	}
+	if len(settings.rules) == 0 {
+		levels = append(levels, rate_limiter.Level{
+			ID: requestID,
+			Rule: Rule{
+				Name:       keyLevelName,
+				Capacity:   capacity,
+				RefillRate: refillRate,
+				Algorithm:  settings.algorithm,
+				Window:     settings.window,
+				WindowUnit: settings.windowUnit,
+				Location:   settings.location,
+			},
+		})
+		return append(levels, quotaLevels...)
+	}
+	for _, rule := range settings.rules {
+		levels = append(levels, rate_limiter.Level{ID: requestID, Rule: rule})
+	}
+
+	// An API key with its own limit gets a token bucket of that limit on top of the rules
+	// The tightest rule and the refill rate of the config fill in the limits the key leaves out
+	if apiKey.Capacity > 0 || apiKey.RefillRate > 0 {
+		keyCapacity, keyRefillRate := apiKey.Capacity, apiKey.RefillRate
+		if keyCapacity == 0 {
+			keyCapacity = settings.capacity
+		}
+		if keyRefillRate == 0 {
+			keyRefillRate = settings.refillRate
+		}
+		levels = append(levels, rate_limiter.Level{
+			ID:   requestID,
+			Rule: Rule{Name: apiKeyLevelName, Capacity: keyCapacity, RefillRate: keyRefillRate},
+		})
+	}
+	return append(levels, quotaLevels...)
+}
+
+// joinKeys joins two keys of a request into the id of a bucket, the first one along with its length,
+// e.g. "4:acme:x:y" for acme and x:y. Both keys can come from the request, so without the length
+// acme with x:y and acme:x with y would share a bucket. It also puts the namespace in front of the ids
+func joinKeys(first, second string) string {
+	return strconv.Itoa(len(first)) + ":" + first + ":" + second
+}
+
+// exceededLevel returns the level a request costs more than, if any - such a request can never be allowed
+func (settings middlewareSettings) exceededLevel(cost, capacity int, route *compiledRoute) (string, bool) {
+	switch {
+	case settings.global.Enabled && cost > settings.global.Capacity:
+		return globalLevelName, true
+	case settings.hierarchy.enabled() && cost > settings.hierarchy.Parent.Capacity:
+		return settings.hierarchy.Parent.Name, true
+	case cost > capacity && route != nil:
+		return route.levelName(), true
+	case cost > capacity:
+		return keyLevelName, true
+	}
+	return "", false
+}
+
+// algorithmConfig returns the algorithm of the config
+// It is passed along with every check, so a reloaded config can switch the algorithm
+func (settings middlewareSettings) algorithmConfig() rate_limiter.AlgorithmConfig {
+	return rate_limiter.AlgorithmConfig{
+		Algorithm:  settings.algorithm,
+		Window:     settings.window,
+		WindowUnit: settings.windowUnit,
+		Location:   settings.location,
+	}
+}
+
+// missingKeyName describes the key a request is missing in the rejection message
+func (settings middlewareSettings) missingKeyName(route *compiledRoute) string {
+	if settings.headerName != "" && (route == nil || route.KeyFunc == nil) {
+		return settings.headerName + " header"
+	}
+	return "rate limit key"
+}
+
+// adaptiveSettings returns the AIMD settings of the adaptive mode
+func (settings middlewareSettings) adaptiveSettings() adaptive.Settings {
+	return adaptive.Settings{
+		MaxRate:        settings.refillRate,
+		MinRate:        settings.adaptive.MinRefillRate,
+		DecreaseFactor: settings.adaptive.DecreaseFactor,
+		IncreaseStep:   settings.adaptive.IncreaseStep,
+	}
+}
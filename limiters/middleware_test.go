@@ -0,0 +1,211 @@
+package limiters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestHandler returns the local middleware of the config around a handler answering 200
+// The config starts from the default local config with the X-ID header as the key
+func newTestHandler(t *testing.T, configure func(config *LocalRateLimiterConfig)) http.Handler {
+	t.Helper()
+	config := GetLocalRateLimiterDefaultConfig()
+	config.UniqueHeaderNameInRequest = "X-ID"
+	configure(&config)
+
+	rl, err := CreateLocalRateLimiter(config)
+	if err != nil {
+		t.Fatalf("CreateLocalRateLimiter: %v", err)
+	}
+	t.Cleanup(func() { StopLocalRateLimiter(rl) })
+
+	middleware, err := LocalMiddleware(rl, config)
+	if err != nil {
+		t.Fatalf("LocalMiddleware: %v", err)
+	}
+	return middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+// writeTestFile writes the content to a file of the name in a temporary directory and returns its path
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestUnlimitedRouteChecksTheKey(t *testing.T) {
+	store, err := LoadAPIKeyStore(writeTestFile(t, "keys.csv", "key,enabled\nactive,true\ndisabled,false\n"), 0)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyStore: %v", err)
+	}
+	defer store.Stop()
+
+	handler := newTestHandler(t, func(config *LocalRateLimiterConfig) {
+		config.Capacity = 1
+		config.APIKeys = store
+		config.Routes = []Route{{Name: "status", Path: "/status", Unlimited: true}}
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+	}{
+		{name: "missing key", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", key: "unknown", wantStatus: http.StatusUnauthorized},
+		{name: "disabled key", key: "disabled", wantStatus: http.StatusForbidden},
+		{name: "enabled key", key: "active", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The bucket of one request is never used up on the unlimited route
+			for i := 0; i < 3; i++ {
+				r := httptest.NewRequest("GET", "/status", nil)
+				if tt.key != "" {
+					r.Header.Set("X-ID", tt.key)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				if w.Code != tt.wantStatus {
+					t.Fatalf("request %d: status = %d, want %d", i, w.Code, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestHierarchyKeysDoNotCollide(t *testing.T) {
+	handler := newTestHandler(t, func(config *LocalRateLimiterConfig) {
+		config.Capacity, config.RefillRate = 1, 0.001
+		config.Hierarchy = HierarchyConfig{
+			ParentKeyFunc: HeaderKey("X-Org"),
+			Parent:        Rule{Name: "org", Capacity: 10, RefillRate: 0.001},
+		}
+	})
+
+	// Each pair joins into the same text, but the keys belong to different parents
+	tests := []struct {
+		parent     string
+		key        string
+		wantStatus int
+	}{
+		{parent: "acme", key: "x:y", wantStatus: http.StatusOK},
+		{parent: "acme:x", key: "y", wantStatus: http.StatusOK},
+		{parent: "acme", key: "x:y", wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Org", tt.parent)
+		r.Header.Set("X-ID", tt.key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("parent %q, key %q: status = %d, want %d", tt.parent, tt.key, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+// recordingLimiter is a Limiter of its own that allows every request and records the keys it gets
+type recordingLimiter struct {
+	keys []string
+}
+
+func (l *recordingLimiter) Allow(ctx context.Context, key string, cost int) (Decision, error) {
+	l.keys = append(l.keys, key)
+	return Decision{Allowed: true, Limit: 1, Remaining: 1}, nil
+}
+
+func TestNamespacesDoNotCollide(t *testing.T) {
+	config := GetLocalRateLimiterDefaultConfig()
+	config.UniqueHeaderNameInRequest = "X-ID"
+	config.Capacity, config.RefillRate = 1, 0.001
+	rl, err := CreateLocalRateLimiter(config)
+	if err != nil {
+		t.Fatalf("CreateLocalRateLimiter: %v", err)
+	}
+	defer StopLocalRateLimiter(rl)
+	recorder := &recordingLimiter{}
+
+	handlers := make(map[string]http.Handler)
+	for _, limiter := range []Limiter{rl, recorder} {
+		for _, namespace := range []string{"", "api"} {
+			config.Namespace = namespace
+			middleware, err := LocalMiddleware(limiter, config)
+			if err != nil {
+				t.Fatalf("LocalMiddleware: %v", err)
+			}
+			name := namespace
+			if limiter == recorder {
+				name = "recorder/" + namespace
+			}
+			handlers[name] = middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		}
+	}
+
+	// The key api:x without a namespace and the key x of the namespace api have their own buckets
+	tests := []struct {
+		handler    string
+		key        string
+		wantStatus int
+	}{
+		{handler: "", key: "api:x", wantStatus: http.StatusOK},
+		{handler: "api", key: "x", wantStatus: http.StatusOK},
+		{handler: "", key: "api:x", wantStatus: http.StatusTooManyRequests},
+		{handler: "recorder/", key: "api:x", wantStatus: http.StatusOK},
+		{handler: "recorder/api", key: "x", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-ID", tt.key)
+		w := httptest.NewRecorder()
+		handlers[tt.handler].ServeHTTP(w, r)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("namespace %q, key %q: status = %d, want %d", tt.handler, tt.key, w.Code, tt.wantStatus)
+		}
+	}
+
+	if want := []string{"0::api:x", "3:api:x"}; fmt.Sprint(recorder.keys) != fmt.Sprint(want) {
+		t.Errorf("the limiter got the keys %q, want %q", recorder.keys, want)
+	}
+}
+
+func TestLocalMiddlewareRejectsGCRA(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(config *LocalRateLimiterConfig)
+	}{
+		{name: "config", configure: func(config *LocalRateLimiterConfig) { config.Algorithm = GCRA }},
+		{name: "rule", configure: func(config *LocalRateLimiterConfig) {
+			config.Rules = []Rule{{Name: "burst", Capacity: 10, RefillRate: 1, Algorithm: GCRA}}
+		}},
+		{name: "route", configure: func(config *LocalRateLimiterConfig) {
+			config.Routes = []Route{{Name: "api", Path: "/api", Capacity: 10, RefillRate: 1, Algorithm: GCRA}}
+		}},
+	}
+
+	// GCRA needs Redis, so the local middleware refuses it wherever it is set
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := GetLocalRateLimiterDefaultConfig()
+			config.UniqueHeaderNameInRequest = "X-ID"
+			tt.configure(&config)
+
+			if _, err := LocalMiddleware(&recordingLimiter{}, config); !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidConfig)
+			}
+		})
+	}
+}
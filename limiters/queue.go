@@ -0,0 +1,119 @@
+package limiters
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// QueueConfig holds the settings of the queueing mode
+// Instead of rejecting a request as soon as its bucket is empty, the request is held
+// until the bucket can take it - smoothing bursts like a leaky bucket
+type QueueConfig struct {
+	Enabled       bool          // Hold requests until they can be allowed instead of rejecting them
+	MaxQueueDepth int           // Maximum number of requests waiting per key - requests past it are rejected
+	MaxWait       time.Duration // Maximum time a request waits - it is rejected after that
+}
+
+// requestQueue holds the waiting requests of every key in FIFO order
+// Only the request at the head of a queue polls its bucket, the others wait for their turn
+type requestQueue struct {
+	mu       sync.Mutex
+	waiting  map[string]*list.List // Waiting requests per key, oldest first
+	maxDepth int
+	maxWait  time.Duration
+	interval time.Duration // How often the head of a queue retries its bucket
+}
+
+// waiter is a single request waiting in a queue
+// turn is closed once the request reaches the head of the queue
+type waiter struct {
+	turn chan struct{}
+}
+
+func newRequestQueue(config QueueConfig, interval time.Duration) *requestQueue {
+	return &requestQueue{
+		waiting:  make(map[string]*list.List),
+		maxDepth: config.MaxQueueDepth,
+		maxWait:  config.MaxWait,
+		interval: min(interval, config.MaxWait),
+	}
+}
+
+// wait holds the request until allow lets it through
+// It returns false if the queue of the key is full, the request waited for longer than
+// the maximum wait or its context was cancelled - the request leaves the queue in every case
+func (q *requestQueue) wait(ctx context.Context, id string, allow func() bool) bool {
+	// Nobody is waiting for this key, so the request does not jump the queue by trying right away
+	q.mu.Lock()
+	_, queued := q.waiting[id]
+	q.mu.Unlock()
+	if !queued && allow() {
+		return true
+	}
+
+	q.mu.Lock()
+	requests, ok := q.waiting[id]
+	if !ok {
+		requests = list.New()
+		q.waiting[id] = requests
+	}
+	if requests.Len() >= q.maxDepth {
+		q.mu.Unlock()
+		return false
+	}
+	w := &waiter{turn: make(chan struct{})}
+	element := requests.PushBack(w)
+	if requests.Len() == 1 {
+		close(w.turn)
+	}
+	q.mu.Unlock()
+	defer q.leave(id, element)
+
+	timeout := time.NewTimer(q.maxWait)
+	defer timeout.Stop()
+
+	// Wait to reach the head of the queue
+	select {
+	case <-w.turn:
+	case <-timeout.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+
+	// Retry the bucket until it takes the request
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	for {
+		if allow() {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// leave removes the request from the queue and hands the turn to the next request
+func (q *requestQueue) leave(id string, element *list.Element) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	requests := q.waiting[id]
+	wasHead := requests.Front() == element
+	requests.Remove(element)
+
+	if requests.Len() == 0 {
+		delete(q.waiting, id)
+		return
+	}
+	if wasHead {
+		close(requests.Front().Value.(*waiter).turn)
+	}
+}
@@ -0,0 +1,126 @@
+package limiters
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestQueueWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		depth     int
+		queued    int  // Requests of the key already waiting
+		allowOn   int  // Call of allow that lets the request through - zero for never
+		cancelled bool // The context of the request is cancelled
+		want      bool
+		wantCalls int32
+	}{
+		{name: "allowed right away", depth: 1, allowOn: 1, want: true, wantCalls: 1},
+		{name: "allowed once the bucket refills", depth: 1, allowOn: 3, want: true, wantCalls: 3},
+		{name: "rejected after the maximum wait", depth: 1, want: false},
+		{name: "rejected when the request is cancelled", depth: 1, cancelled: true, want: false},
+		{name: "rejected when the queue is full", depth: 1, queued: 1, allowOn: 1, want: false, wantCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newRequestQueue(QueueConfig{Enabled: true, MaxQueueDepth: tt.depth, MaxWait: 50 * time.Millisecond}, time.Millisecond)
+
+			// The requests already queued never get through, so they hold the head of the queue
+			blocked, unblock := context.WithCancel(context.Background())
+			defer unblock()
+			for i := 0; i < tt.queued; i++ {
+				go q.wait(blocked, "key", func() bool { return false })
+			}
+			waitForQueue(t, q, "key", tt.queued)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			var calls atomic.Int32
+			got := q.wait(ctx, "key", func() bool {
+				return calls.Add(1) == int32(tt.allowOn)
+			})
+			if got != tt.want {
+				t.Errorf("wait = %v, want %v", got, tt.want)
+			}
+			if tt.want && calls.Load() != tt.wantCalls {
+				t.Errorf("allow was called %d times, want %d", calls.Load(), tt.wantCalls)
+			}
+			if tt.queued > 0 && calls.Load() != tt.wantCalls {
+				t.Errorf("allow was called %d times behind the queue, want %d", calls.Load(), tt.wantCalls)
+			}
+
+			unblock()
+			waitForQueue(t, q, "key", 0)
+		})
+	}
+}
+
+func TestRequestQueueFIFO(t *testing.T) {
+	q := newRequestQueue(QueueConfig{Enabled: true, MaxQueueDepth: 3, MaxWait: time.Second}, time.Millisecond)
+
+	// A token is handed out at a time and the requests must take them in the order they arrived
+	var tokens atomic.Int32
+	allow := func() bool {
+		for {
+			n := tokens.Load()
+			if n == 0 {
+				return false
+			}
+			if tokens.CompareAndSwap(n, n-1) {
+				return true
+			}
+		}
+	}
+
+	done := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			if q.wait(context.Background(), "key", allow) {
+				done <- i
+			}
+		}(i)
+		waitForQueue(t, q, "key", i+1)
+	}
+
+	for want := 0; want < 3; want++ {
+		tokens.Store(1)
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("request %d got through, want request %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %d never got through", want)
+		}
+	}
+	waitForQueue(t, q, "key", 0)
+}
+
+// waitForQueue waits until the queue of the key holds n requests
+func waitForQueue(t *testing.T, q *requestQueue, id string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		length := 0
+		if requests, ok := q.waiting[id]; ok {
+			length = requests.Len()
+		}
+		q.mu.Unlock()
+
+		if length == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue holds %d requests, want %d", length, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,167 @@
+package limiters
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// Decision is the outcome of a rate limit check - whether the request is allowed, the limit of the bucket,
+// the tokens left and the time until the request would be allowed and until the bucket is full again
+type Decision = rate_limiter.Result
+
+// Names of the quota, API key and concurrency checks in the rejections
+const (
+	quotaLevelName       = "quota"
+	apiKeyLevelName      = "api_key"
+	concurrencyLevelName = "concurrency"
+)
+
+// RejectionReason tells why a request was rejected
+type RejectionReason string
+
+const (
+	ReasonMissingKey          RejectionReason = "missing_key"           // The request has no key and there is no default key
+	ReasonInvalidKey          RejectionReason = "invalid_key"           // The key of the request failed verification, e.g. a forged token
+	ReasonUnknownAPIKey       RejectionReason = "unknown_api_key"       // The key is not in the API key store
+	ReasonAPIKeyDisabled      RejectionReason = "api_key_disabled"      // The API key is disabled
+	ReasonMissingParentKey    RejectionReason = "missing_parent_key"    // The request has no parent key under a hierarchy
+	ReasonCostExceedsCapacity RejectionReason = "cost_exceeds_capacity" // The request costs more than a whole bucket
+	ReasonRateLimited         RejectionReason = "rate_limited"          // A bucket of the request has no room for it
+	ReasonQuotaExceeded       RejectionReason = "quota_exceeded"        // The daily quota of the API key is used up
+	ReasonTooManyConcurrent   RejectionReason = "too_many_concurrent"   // The key or the target has too many requests in flight
+	ReasonBackendUnavailable  RejectionReason = "backend_unavailable"   // The rate limiter failed, e.g. Redis is down - sent with 503
+)
+
+// Rejection describes a request the middleware turns away
+type Rejection struct {
+	Reason   RejectionReason // Why the request was rejected
+	Status   int             // Status code of the response
+	Message  string          // Human readable message, e.g. "Too many requests - organisation limit reached"
+	Key      string          // Key of the request - empty when it has none, the hash of an API key
+	Rule     string          // Name of the rule or level that rejected the request, e.g. key, global or the name of a rule
+	Decision *Decision       // Decision of the bucket that rejected the request - nil when no bucket was checked
+}
+
+// RejectionHandler writes the response of a rejected request
+// The rate limit headers and Retry-After are already set when it is called
+type RejectionHandler func(w http.ResponseWriter, r *http.Request, rejection Rejection)
+
+// RejectionConfig customises the responses of the rejected requests
+type RejectionConfig struct {
+	Handler      RejectionHandler // Writes the responses - PlainTextRejection when nil
+	Status       int              // Status code of the rate limited requests - 429 when zero
+	GlobalStatus int              // Status code when the global bucket rejects the request, e.g. 503 for overload - Status when zero
+}
+
+// validate checks the status codes of the rejections
+func (config RejectionConfig) validate() error {
+	for _, status := range []int{config.Status, config.GlobalStatus} {
+		if status != 0 && (status < 400 || status > 599) {
+			return fmt.Errorf("rejection status codes must be between 400 and 599, got %d", status)
+		}
+	}
+	return nil
+}
+
+// limitedStatus returns the status code of a request rejected by the rule
+func (config RejectionConfig) limitedStatus(rule string) int {
+	if rule == globalLevelName && config.GlobalStatus != 0 {
+		return config.GlobalStatus
+	}
+	if config.Status != 0 {
+		return config.Status
+	}
+	return http.StatusTooManyRequests
+}
+
+// reject hands the rejection to the handler of the config
+func (config RejectionConfig) reject(w http.ResponseWriter, r *http.Request, rejection Rejection) {
+	if config.Handler == nil {
+		PlainTextRejection(w, r, rejection)
+		return
+	}
+	config.Handler(w, r, rejection)
+}
+
+// PlainTextRejection writes the message of the rejection as plain text - the default
+func PlainTextRejection(w http.ResponseWriter, r *http.Request, rejection Rejection) {
+	http.Error(w, rejection.Message, rejection.Status)
+}
+
+// JSONRejection writes the rejections as JSON
+// body builds the JSON of a rejection, e.g. the error shape a client expects. When nil the body is
+//
+//	{"error": "rate_limited", "message": "Too many requests", "key": "abc", "rule": "key",
+//	 "limit": 20, "remaining": 0, "retry_after": 3, "reset": 4}
+//
+// with retry_after and reset in seconds and the rate limit fields only for the requests a bucket rejected
+func JSONRejection(body func(rejection Rejection) any) RejectionHandler {
+	if body == nil {
+		body = func(rejection Rejection) any { return defaultJSONBody(rejection) }
+	}
+	return func(w http.ResponseWriter, r *http.Request, rejection Rejection) {
+		writeJSON(w, "application/json", rejection.Status, body(rejection))
+	}
+}
+
+// ProblemDetailsRejection writes the rejections as RFC 9457 problem details - application/problem+json
+// docsURL links the documentation of the errors: the type of a problem is docsURL#reason,
+// e.g. https://api.example.com/docs/errors#rate_limited. The type is about:blank when it is empty.
+// The key, rule and rate limit fields are added as extension members
+func ProblemDetailsRejection(docsURL string) RejectionHandler {
+	return func(w http.ResponseWriter, r *http.Request, rejection Rejection) {
+		problem := defaultJSONBody(rejection)
+		delete(problem, "error")
+		delete(problem, "message")
+
+		problem["type"] = "about:blank"
+		if docsURL != "" {
+			problem["type"] = strings.TrimSuffix(docsURL, "#") + "#" + string(rejection.Reason)
+		}
+		problem["title"] = http.StatusText(rejection.Status)
+		problem["status"] = rejection.Status
+		problem["detail"] = rejection.Message
+		problem["instance"] = r.URL.Path
+		problem["reason"] = rejection.Reason
+
+		writeJSON(w, "application/problem+json", rejection.Status, problem)
+	}
+}
+
+// defaultJSONBody is the JSON body of a rejection used by JSONRejection
+func defaultJSONBody(rejection Rejection) map[string]any {
+	body := map[string]any{
+		"error":   rejection.Reason,
+		"message": rejection.Message,
+	}
+	if rejection.Key != "" {
+		body["key"] = rejection.Key
+	}
+	if rejection.Rule != "" {
+		body["rule"] = rejection.Rule
+	}
+	if rejection.Decision != nil {
+		body["limit"] = rejection.Decision.Limit
+		body["remaining"] = max(0, rejection.Decision.Remaining)
+		body["retry_after"] = max(1, seconds(rejection.Decision.RetryAfter))
+		body["reset"] = seconds(rejection.Decision.ResetAfter)
+	}
+	return body
+}
+
+// writeJSON writes the body as JSON with the content type and status code
+func writeJSON(w http.ResponseWriter, contentType string, status int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(data, '\n'))
+}
@@ -0,0 +1,258 @@
+package limiters
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/krishpatel023/ratelimiter/internal/helper"
+)
+
+// ReloadableHandler is a reverse proxy rate limiting middleware whose config can be reloaded while it serves requests
+// A reload swaps the limits, rules, routes and keys of the middleware atomically - a request is handled
+// entirely by the config it started with. The buckets live in the rate limiter and are kept, so a key
+// keeps its state and its bucket picks up the new capacity and refill rate on its next request - a bucket
+// whose window changed starts over with the new one.
+// Reloads can come from a signal, a change of the config file or an API call
+type ReloadableHandler struct {
+	load    func() (middlewareSettings, limiterBackend, string, error) // Loads the current config
+	mu      sync.Mutex                                                 // Serializes the reloads
+	current atomic.Pointer[reloadState]                                // Handler of the current config
+}
+
+// reloadState is the handler built from one config
+type reloadState struct {
+	handler  http.Handler       // Rate limiting middleware of the config
+	settings middlewareSettings // Settings of the config
+	target   string             // Target URL of the reverse proxy
+	proxy    http.Handler       // Reverse proxy to the target - kept across reloads while the target is the same
+}
+
+// LocalReloadableMiddleware creates a reloadable middleware for the local rate limiter
+// load is called on every reload, e.g. LocalConfigLoader("ratelimiter.yaml").
+// The rate limiter itself is not recreated - MaxEntries and the cleanup settings stay as they were
+func LocalReloadableMiddleware(rl Limiter, load func() (LocalRateLimiterConfig, error)) (*ReloadableHandler, error) {
+	return newReloadableHandler(func() (middlewareSettings, limiterBackend, string, error) {
+		config, err := load()
+		if err != nil {
+			return middlewareSettings{}, limiterBackend{}, "", err
+		}
+		settings, err := config.middlewareSettings()
+		if err != nil {
+			return middlewareSettings{apiKeys: config.APIKeys}, limiterBackend{}, "", err
+		}
+		backend, err := newBackend(rl, settings)
+		return settings, backend, config.TargetURL, err
+	})
+}
+
+// DistributedReloadableMiddleware creates a reloadable middleware for the distributed rate limiter
+// load is called on every reload, e.g. DistributedConfigLoader("ratelimiter.yaml").
+// The rate limiter itself is not recreated - the Redis connection and key prefix stay as they were
+func DistributedReloadableMiddleware(rl Limiter, load func() (DistributedRateLimiterConfig, error)) (*ReloadableHandler, error) {
+	return newReloadableHandler(func() (middlewareSettings, limiterBackend, string, error) {
+		config, err := load()
+		if err != nil {
+			return middlewareSettings{}, limiterBackend{}, "", err
+		}
+		settings, err := config.middlewareSettings()
+		if err != nil {
+			return middlewareSettings{apiKeys: config.APIKeys}, limiterBackend{}, "", err
+		}
+		backend, err := newBackend(rl, settings)
+		return settings, backend, config.TargetURL, err
+	})
+}
+
+// LocalConfigLoader loads the local config from a config file on every call
+func LocalConfigLoader(path string) func() (LocalRateLimiterConfig, error) {
+	return func() (LocalRateLimiterConfig, error) {
+		file, err := LoadConfigFile(path)
+		if err != nil {
+			return LocalRateLimiterConfig{}, err
+		}
+		return file.LocalConfig()
+	}
+}
+
+// DistributedConfigLoader loads the distributed config from a config file on every call
+func DistributedConfigLoader(path string) func() (DistributedRateLimiterConfig, error) {
+	return func() (DistributedRateLimiterConfig, error) {
+		file, err := LoadConfigFile(path)
+		if err != nil {
+			return DistributedRateLimiterConfig{}, err
+		}
+		return file.DistributedConfig()
+	}
+}
+
+// newReloadableHandler creates the handler and loads the first config
+func newReloadableHandler(load func() (middlewareSettings, limiterBackend, string, error)) (*ReloadableHandler, error) {
+	h := &ReloadableHandler{load: load}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ServeHTTP hands the request to the middleware of the current config
+func (h *ReloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.current.Load().handler.ServeHTTP(w, r)
+}
+
+// Reload loads the config again and swaps it in
+// The current config stays in place if the new one fails to load or is invalid
+func (h *ReloadableHandler) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous := h.current.Load()
+	settings, backend, target, err := h.load()
+	if err != nil {
+		previous.discardAPIKeys(settings)
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	var proxy http.Handler
+	if previous != nil && previous.target == target {
+		proxy = previous.proxy
+	} else if proxy, err = reverseProxy(target); err != nil {
+		previous.discardAPIKeys(settings)
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	// The adaptive refill rate carries over, capped by the new refill rate
+	if previous != nil && previous.settings.rate != nil && settings.rate != nil {
+		settings.rate.store(min(previous.settings.rate.load(), settings.refillRate))
+	}
+
+	h.current.Store(&reloadState{
+		handler:  rateLimitHandler(backend, settings, proxy),
+		settings: settings,
+		target:   target,
+		proxy:    proxy,
+	})
+
+	// The file watcher of a replaced API key store is stopped
+	if previous != nil && previous.settings.apiKeys != nil && previous.settings.apiKeys != settings.apiKeys {
+		previous.settings.apiKeys.Stop()
+	}
+	return nil
+}
+
+// discardAPIKeys stops the file watcher of the API key store of a config that failed to load
+// The store of the current config is kept, e.g. when the loader returns the same config every time
+func (state *reloadState) discardAPIKeys(settings middlewareSettings) {
+	if settings.apiKeys == nil || (state != nil && state.settings.apiKeys == settings.apiKeys) {
+		return
+	}
+	settings.apiKeys.Stop()
+}
+
+// ReloadOnSignal reloads the config whenever the process gets one of the signals - SIGHUP when none are given
+// The returned function stops listening
+func (h *ReloadableHandler) ReloadOnSignal(signals ...os.Signal) func() {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-received:
+				h.reloadAndLog("signal " + sig.String())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+}
+
+// WatchFile reloads the config whenever the file changes, checked every interval
+// An interval of zero or less checks every second. The returned function stops watching
+func (h *ReloadableHandler) WatchFile(path string, interval time.Duration) func() {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var modTime time.Time
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			modTime, size = info.ModTime(), info.Size()
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil {
+					helper.Log("Failed to check config file: "+err.Error(), "error")
+					continue
+				}
+				if info.ModTime().Equal(modTime) && info.Size() == size {
+					continue
+				}
+				modTime, size = info.ModTime(), info.Size()
+				h.reloadAndLog("change of " + path)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// ReloadHandler returns an API endpoint that reloads the config on POST
+// Keep it away from untrusted clients, e.g. on an admin port
+func (h *ReloadableHandler) ReloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := h.Reload(); err != nil {
+			helper.Log(err.Error(), "error")
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		helper.Log("Config reloaded through the API", "info")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Config reloaded\n"))
+	})
+}
+
+// reloadAndLog reloads the config and logs the outcome
+func (h *ReloadableHandler) reloadAndLog(reason string) {
+	if err := h.Reload(); err != nil {
+		helper.Log(err.Error()+" - keeping the current config", "error")
+		return
+	}
+	helper.Log("Config reloaded on "+reason, "info")
+}
@@ -0,0 +1,191 @@
+package limiters
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestReloadableHandler returns a reloadable local middleware proxying to a target answering 200
+// Every reload calls load with a config starting from the default local config with the X-ID header as the key
+func newTestReloadableHandler(t *testing.T, load func(config *LocalRateLimiterConfig) error) *ReloadableHandler {
+	t.Helper()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(target.Close)
+
+	newConfig := func() LocalRateLimiterConfig {
+		config := GetLocalRateLimiterDefaultConfig()
+		config.UniqueHeaderNameInRequest = "X-ID"
+		config.TargetURL = target.URL
+		return config
+	}
+
+	rl, err := CreateLocalRateLimiter(newConfig())
+	if err != nil {
+		t.Fatalf("CreateLocalRateLimiter: %v", err)
+	}
+	t.Cleanup(func() { StopLocalRateLimiter(rl) })
+
+	h, err := LocalReloadableMiddleware(rl, func() (LocalRateLimiterConfig, error) {
+		config := newConfig()
+		err := load(&config)
+		return config, err
+	})
+	if err != nil {
+		t.Fatalf("LocalReloadableMiddleware: %v", err)
+	}
+	return h
+}
+
+// serveTest sends a request of the key to the handler and returns the status code
+func serveTest(h http.Handler, key string) int {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-ID", key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestReloadKeepsState(t *testing.T) {
+	capacity := 2
+	h := newTestReloadableHandler(t, func(config *LocalRateLimiterConfig) error {
+		config.Capacity = capacity
+		config.RefillRate = 0.001
+		return nil
+	})
+
+	for i := 0; i < capacity; i++ {
+		if code := serveTest(h, "a"); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+
+	// The bucket of the key stays empty with the larger capacity, a new key gets all of it
+	capacity = 3
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if code := serveTest(h, "a"); code != http.StatusTooManyRequests {
+		t.Errorf("used up key after reload: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	for i := 0; i < capacity; i++ {
+		if code := serveTest(h, "b"); code != http.StatusOK {
+			t.Fatalf("new key request %d: status = %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if code := serveTest(h, "b"); code != http.StatusTooManyRequests {
+		t.Errorf("new key past the new capacity: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestReloadFailureKeepsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		load func(config *LocalRateLimiterConfig) error
+	}{
+		{name: "loader error", load: func(config *LocalRateLimiterConfig) error { return errors.New("file not found") }},
+		{name: "invalid config", load: func(config *LocalRateLimiterConfig) error {
+			config.Capacity = -1
+			return nil
+		}},
+		{name: "invalid target", load: func(config *LocalRateLimiterConfig) error {
+			config.Capacity = 100
+			config.TargetURL = "://"
+			return nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failing bool
+			h := newTestReloadableHandler(t, func(config *LocalRateLimiterConfig) error {
+				if failing {
+					return tt.load(config)
+				}
+				config.Capacity = 1
+				config.RefillRate = 0.001
+				return nil
+			})
+
+			failing = true
+			if err := h.Reload(); err == nil {
+				t.Fatal("Reload succeeded, want an error")
+			}
+
+			// The capacity of 1 is still in place
+			if code := serveTest(h, "a"); code != http.StatusOK {
+				t.Fatalf("first request: status = %d, want %d", code, http.StatusOK)
+			}
+			if code := serveTest(h, "a"); code != http.StatusTooManyRequests {
+				t.Errorf("second request: status = %d, want %d", code, http.StatusTooManyRequests)
+			}
+		})
+	}
+}
+
+func TestReloadStopsAPIKeyStores(t *testing.T) {
+	path := writeTestFile(t, "keys.csv", "key\nactive\n")
+	var stores []*APIKeyStore
+	var invalid bool
+	h := newTestReloadableHandler(t, func(config *LocalRateLimiterConfig) error {
+		store, err := LoadAPIKeyStore(path, time.Hour)
+		if err != nil {
+			return err
+		}
+		stores = append(stores, store)
+		config.APIKeys = store
+		if invalid {
+			config.Capacity = -1
+		}
+		return nil
+	})
+	t.Cleanup(func() { stores[len(stores)-1].Stop() })
+
+	stopped := func(store *APIKeyStore) bool {
+		select {
+		case <-store.stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// A reload stops the store it replaces
+	if err := h.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if !stopped(stores[0]) {
+		t.Error("replaced store was not stopped")
+	}
+	if stopped(stores[1]) {
+		t.Error("current store was stopped")
+	}
+
+	// A failed reload stops its own store and keeps the current one
+	invalid = true
+	if err := h.Reload(); err == nil {
+		t.Fatal("Reload succeeded, want an error")
+	}
+	if !stopped(stores[2]) {
+		t.Error("store of the failed reload was not stopped")
+	}
+	if stopped(stores[1]) {
+		t.Error("current store was stopped by the failed reload")
+	}
+	if code := serveTest(h, "active"); code != http.StatusOK {
+		t.Errorf("request with the current store: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestWatchFileNonPositiveInterval(t *testing.T) {
+	h := newTestReloadableHandler(t, func(config *LocalRateLimiterConfig) error { return nil })
+
+	// A zero or negative interval falls back to the default instead of panicking
+	for _, interval := range []time.Duration{0, -time.Second} {
+		stop := h.WatchFile(writeTestFile(t, "ratelimiter.yaml", ""), interval)
+		time.Sleep(10 * time.Millisecond)
+		stop()
+	}
+}
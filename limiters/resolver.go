@@ -0,0 +1,106 @@
+package limiters
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Limit is the limit a single key is held to
+type Limit struct {
+	Capacity   int     // Capacity of the bucket of the key
+	RefillRate float64 // Refill rate of the bucket of the key
+	Cost       int     // Tokens the request costs - zero to use the Cost function of the config
+}
+
+// LimitResolver returns the limit of a key, e.g. from the plan of the customer it belongs to
+// When it fails the request is held to the Capacity and RefillRate of the config
+type LimitResolver interface {
+	ResolveLimit(key string, r *http.Request) (Limit, error)
+}
+
+// LimitResolverFunc lets an ordinary function be used as a LimitResolver
+type LimitResolverFunc func(key string, r *http.Request) (Limit, error)
+
+func (f LimitResolverFunc) ResolveLimit(key string, r *http.Request) (Limit, error) {
+	return f(key, r)
+}
+
+// CachingResolver keeps the limits returned by a slow resolver, e.g. one backed by a database
+// Limits are cached per key for the TTL, so a resolver whose answer depends on more than the key
+// should not be wrapped. Errors are not cached, and concurrent misses for a key share one lookup
+type CachingResolver struct {
+	resolver LimitResolver
+	ttl      time.Duration
+	cache    *lru.Cache
+
+	mu      sync.Mutex
+	pending map[string]*pendingLookup // Lookups in progress per key
+}
+
+// cachedLimit is a limit along with the time it stops being valid
+type cachedLimit struct {
+	limit     Limit
+	expiresAt time.Time
+}
+
+// pendingLookup is a lookup other requests for the same key wait on
+type pendingLookup struct {
+	done  chan struct{}
+	limit Limit
+	err   error
+}
+
+// NewCachingResolver wraps resolver with a cache of up to maxEntries keys kept for ttl
+func NewCachingResolver(resolver LimitResolver, ttl time.Duration, maxEntries int) (*CachingResolver, error) {
+	cache, err := lru.New(maxEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CachingResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		cache:    cache,
+		pending:  make(map[string]*pendingLookup),
+	}, nil
+}
+
+func (c *CachingResolver) ResolveLimit(key string, r *http.Request) (Limit, error) {
+	if val, ok := c.cache.Get(key); ok {
+		cached := val.(cachedLimit)
+		if time.Now().Before(cached.expiresAt) {
+			return cached.limit, nil
+		}
+	}
+
+	// Wait for the lookup already in progress for the key, if any
+	c.mu.Lock()
+	if lookup, ok := c.pending[key]; ok {
+		c.mu.Unlock()
+		<-lookup.done
+		return lookup.limit, lookup.err
+	}
+	lookup := &pendingLookup{done: make(chan struct{})}
+	c.pending[key] = lookup
+	c.mu.Unlock()
+
+	lookup.limit, lookup.err = c.resolver.ResolveLimit(key, r)
+	if lookup.err == nil {
+		c.cache.Add(key, cachedLimit{limit: lookup.limit, expiresAt: time.Now().Add(c.ttl)})
+	}
+
+	c.mu.Lock()
+	delete(c.pending, key)
+	c.mu.Unlock()
+	close(lookup.done)
+
+	return lookup.limit, lookup.err
+}
+
+// Invalidate drops the cached limit of a key, e.g. after the customer changed plans
+func (c *CachingResolver) Invalidate(key string) {
+	c.cache.Remove(key)
+}
@@ -1,32 +1,57 @@
 package limiters
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
-
-	"github.com/krishpatel023/ratelimiter/internal/helper"
 )
 
 // ReverseProxyConfig holds configuration for the reverse proxy
 // It is used to set up the reverse proxy by the rate limiter middleware
-func reverseProxy(TargetURL string) http.Handler {
+// An invalid target URL returns an error wrapping ErrInvalidTargetURL
+func reverseProxy(TargetURL string) (http.Handler, error) {
 	// Define the backend server URL
-	targetURL, err := url.Parse(TargetURL)
-	if err != nil || targetURL.String() == "" {
-		helper.Log(fmt.Sprintf("Failed to parse target URL: %v", "Please add/check the target URL"), "error")
-		os.Exit(1)
+	targetURL, err := parseTargetURL(TargetURL)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
+	// The rate limit headers set by the middleware win over the ones of the target
+	// The response headers of the middleware travel with the request to the response of the target
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		header, ok := resp.Request.Context().Value(responseHeaderKey{}).(http.Header)
+		if !ok {
+			return nil
+		}
+		for _, name := range rateLimitHeaders {
+			if header.Get(name) != "" {
+				resp.Header.Del(name)
+			}
+		}
+		return nil
+	}
+
 	// Set up the handler
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		proxy.ServeHTTP(w, r)
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), responseHeaderKey{}, w.Header())))
 	})
 
-	return handler
+	return handler, nil
+}
+
+// responseHeaderKey is the context key of the response headers already set for a proxied request
+type responseHeaderKey struct{}
+
+// parseTargetURL parses the target URL of the reverse proxy - it must be absolute, e.g. http://localhost:8081
+func parseTargetURL(TargetURL string) (*url.URL, error) {
+	targetURL, err := url.Parse(TargetURL)
+	if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+		return nil, fmt.Errorf("%w %q - Please add/check the target URL", ErrInvalidTargetURL, TargetURL)
+	}
+	return targetURL, nil
 }
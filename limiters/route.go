@@ -0,0 +1,188 @@
+package limiters
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// PathMatch selects how the Path of a route is matched against the path of a request
+type PathMatch string
+
+const (
+	// PathPrefix matches the paths starting with the pattern on a segment boundary - "/api" matches "/api"
+	// and "/api/users" but not "/apiary"
+	PathPrefix PathMatch = "prefix"
+	// PathGlob matches the paths with path.Match - "/users/*/orders" matches "/users/42/orders"
+	PathGlob PathMatch = "glob"
+	// PathRegex matches the paths with a regular expression - "^/users/[0-9]+$" matches "/users/42"
+	PathRegex PathMatch = "regex"
+)
+
+// Route gives the requests matching a path, method and host their own limits
+// Routes are matched in order and the first match wins. Requests matching no route get the limits,
+// KeyFunc and Cost of the config - the default route. Every route counts the requests of a key in its
+// own bucket, so the same client has independent limits on /login and on GET /status
+type Route struct {
+	Name       string         // Names the route and its buckets - must be unique among the routes
+	Path       string         // Pattern of the path - empty matches every path
+	PathMatch  PathMatch      // How Path is matched - PathPrefix (default), PathGlob or PathRegex
+	Methods    []string       // Methods matched, e.g. "GET" or "POST" - empty matches every method
+	Host       string         // Host matched, without the port - empty matches every host
+	Unlimited  bool           // Requests matching the route are never rate limited - their key is still checked
+	Capacity   int            // Capacity of the bucket of each key on the route
+	RefillRate float64        // Refill rate of the bucket of each key on the route
+	Algorithm  Algorithm      // Algorithm of the route - defaults to TokenBucket
+	Window     time.Duration  // Window of the window based algorithms
+	WindowUnit WindowUnit     // Calendar unit the FixedWindow windows align to
+	Location   *time.Location // Time zone of the calendar windows - defaults to UTC
+	KeyFunc    KeyFunc        // Extracts the key of a request on the route - the KeyFunc of the config when nil
+	Cost       CostFunc       // Tokens a request on the route costs - the Cost of the config when nil
+}
+
+// compiledRoute is a route with its path pattern ready for matching
+type compiledRoute struct {
+	Route
+	pattern *regexp.Regexp // Compiled Path of the PathRegex routes
+}
+
+// compileRoutes validates the routes and compiles their path patterns
+func compileRoutes(routes []Route) ([]compiledRoute, error) {
+	compiled := make([]compiledRoute, 0, len(routes))
+	names := make(map[string]bool, len(routes))
+
+	for i, route := range routes {
+		if route.Name == "" {
+			return nil, fmt.Errorf("route %d: name is empty", i+1)
+		}
+		if names[route.Name] {
+			return nil, fmt.Errorf("route %q: duplicate name", route.Name)
+		}
+		names[route.Name] = true
+
+		current := compiledRoute{Route: route}
+		switch route.PathMatch {
+		case "", PathPrefix:
+		case PathGlob:
+			if _, err := path.Match(route.Path, "/"); err != nil {
+				return nil, fmt.Errorf("route %q: invalid glob %q", route.Name, route.Path)
+			}
+		case PathRegex:
+			pattern, err := regexp.Compile(route.Path)
+			if err != nil {
+				return nil, fmt.Errorf("route %q: %w", route.Name, err)
+			}
+			current.pattern = pattern
+		default:
+			return nil, fmt.Errorf("route %q: unknown path match %q", route.Name, route.PathMatch)
+		}
+
+		if !route.Unlimited {
+			if err := rate_limiter.ValidateRules([]Rule{current.rule(route.Capacity, route.RefillRate)}); err != nil {
+				return nil, fmt.Errorf("route %q: %w", route.Name, err)
+			}
+		}
+		compiled = append(compiled, current)
+	}
+	return compiled, nil
+}
+
+// matches reports if the request matches the path, method and host of the route
+// urlPath is the cleaned path of the request - see cleanPath
+func (route compiledRoute) matches(r *http.Request, urlPath string) bool {
+	if len(route.Methods) > 0 {
+		matched := false
+		for _, method := range route.Methods {
+			if strings.EqualFold(method, r.Method) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if route.Host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, route.Host) {
+			return false
+		}
+	}
+
+	if route.Path == "" {
+		return true
+	}
+	switch route.PathMatch {
+	case PathGlob:
+		matched, _ := path.Match(route.Path, urlPath)
+		return matched
+	case PathRegex:
+		return route.pattern.MatchString(urlPath)
+	default:
+		return matchPrefix(urlPath, route.Path)
+	}
+}
+
+// cleanPath returns the path the target serves for the path of a request, e.g. /login for //login or /./login,
+// so a request cannot slip past its route with another spelling of the path. A trailing slash is kept
+func cleanPath(urlPath string) string {
+	if urlPath == "" || urlPath[0] != '/' {
+		urlPath = "/" + urlPath
+	}
+	cleaned := path.Clean(urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// matchPrefix reports if the path is the prefix or continues it with a new segment
+// A prefix ending with a slash already ends on a segment boundary
+func matchPrefix(urlPath, prefix string) bool {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return false
+	}
+	return len(urlPath) == len(prefix) || strings.HasSuffix(prefix, "/") || urlPath[len(prefix)] == '/'
+}
+
+// rule returns the limit of the route as a rule named after the route, which namespaces its buckets
+func (route compiledRoute) rule(capacity int, refillRate float64) Rule {
+	return Rule{
+		Name:       route.levelName(),
+		Capacity:   capacity,
+		RefillRate: refillRate,
+		Algorithm:  route.Algorithm,
+		Window:     route.Window,
+		WindowUnit: route.WindowUnit,
+		Location:   route.Location,
+	}
+}
+
+// levelName names the level of the route in rejections and in the name of its buckets
+func (route compiledRoute) levelName() string {
+	return "route:" + route.Name
+}
+
+// matchRoute returns the first route the request matches, nil for the default route
+func (settings middlewareSettings) matchRoute(r *http.Request) *compiledRoute {
+	if len(settings.routes) == 0 {
+		return nil
+	}
+	urlPath := cleanPath(r.URL.Path)
+	for i := range settings.routes {
+		if settings.routes[i].matches(r, urlPath) {
+			return &settings.routes[i]
+		}
+	}
+	return nil
+}
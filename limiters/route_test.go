@@ -0,0 +1,115 @@
+package limiters
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  Route
+		method string
+		host   string
+		path   string
+		want   bool
+	}{
+		{name: "prefix matches the path itself", route: Route{Path: "/api"}, path: "/api", want: true},
+		{name: "prefix matches a sub path", route: Route{Path: "/api"}, path: "/api/users", want: true},
+		{name: "prefix stops at a segment boundary", route: Route{Path: "/api"}, path: "/apiary", want: false},
+		{name: "prefix ending with a slash", route: Route{Path: "/api/"}, path: "/api/users", want: true},
+		{name: "prefix ending with a slash needs the slash", route: Route{Path: "/api/"}, path: "/api", want: false},
+		{name: "trailing slash is kept", route: Route{Path: "/api/"}, path: "/api/", want: true},
+		{name: "empty path matches every path", route: Route{}, path: "/anything", want: true},
+		{name: "double slash", route: Route{Path: "/login"}, path: "//login", want: true},
+		{name: "dot segment", route: Route{Path: "/login"}, path: "/./login", want: true},
+		{name: "dot dot segment", route: Route{Path: "/login"}, path: "/static/../login", want: true},
+		{name: "glob matches one segment", route: Route{Path: "/users/*/orders", PathMatch: PathGlob}, path: "/users/42/orders", want: true},
+		{name: "glob does not cross segments", route: Route{Path: "/users/*/orders", PathMatch: PathGlob}, path: "/users/42/7/orders", want: false},
+		{name: "glob on a cleaned path", route: Route{Path: "/users/*/orders", PathMatch: PathGlob}, path: "/users//42/orders", want: true},
+		{name: "regex", route: Route{Path: "^/reports/[0-9]+/export$", PathMatch: PathRegex}, path: "/reports/7/export", want: true},
+		{name: "regex mismatch", route: Route{Path: "^/reports/[0-9]+/export$", PathMatch: PathRegex}, path: "/reports/x/export", want: false},
+		{name: "method in any case", route: Route{Methods: []string{"get", "POST"}}, method: "GET", path: "/", want: true},
+		{name: "other method", route: Route{Methods: []string{"POST"}}, method: "GET", path: "/", want: false},
+		{name: "host without the port", route: Route{Host: "api.example.com"}, host: "API.example.com:8443", path: "/", want: true},
+		{name: "other host", route: Route{Host: "api.example.com"}, host: "www.example.com", path: "/", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Name = "route"
+			tt.route.Capacity, tt.route.RefillRate = 1, 1
+			routes, err := compileRoutes([]Route{tt.route})
+			if err != nil {
+				t.Fatalf("compileRoutes: %v", err)
+			}
+
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			r.URL.Path = tt.path
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+
+			settings := middlewareSettings{routes: routes}
+			if got := settings.matchRoute(r) != nil; got != tt.want {
+				t.Errorf("matched = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRouteFirstMatchWins(t *testing.T) {
+	routes, err := compileRoutes([]Route{
+		{Name: "status", Path: "/status", Unlimited: true},
+		{Name: "login", Path: "/login", Methods: []string{"POST"}, Capacity: 5, RefillRate: 1},
+		{Name: "api", Path: "/", Capacity: 100, RefillRate: 10},
+	})
+	if err != nil {
+		t.Fatalf("compileRoutes: %v", err)
+	}
+	settings := middlewareSettings{routes: routes}
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/status", "status"},
+		{"POST", "/login", "login"},
+		{"GET", "/login", "api"},
+		{"POST", "//login/", "login"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.URL.Path = tt.path
+		route := settings.matchRoute(r)
+		if route == nil || route.Name != tt.want {
+			t.Errorf("%s %s matched %v, want %s", tt.method, tt.path, route, tt.want)
+		}
+	}
+}
+
+func TestCompileRoutesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+	}{
+		{name: "missing name", route: Route{Path: "/", Capacity: 1, RefillRate: 1}},
+		{name: "invalid glob", route: Route{Name: "glob", Path: "/[", PathMatch: PathGlob, Capacity: 1, RefillRate: 1}},
+		{name: "invalid regex", route: Route{Name: "regex", Path: "(", PathMatch: PathRegex, Capacity: 1, RefillRate: 1}},
+		{name: "unknown path match", route: Route{Name: "exact", Path: "/", PathMatch: "exact", Capacity: 1, RefillRate: 1}},
+		{name: "missing capacity", route: Route{Name: "api", Path: "/", RefillRate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileRoutes([]Route{tt.route}); err == nil {
+				t.Error("compileRoutes did not fail")
+			}
+		})
+	}
+}
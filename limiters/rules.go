@@ -0,0 +1,38 @@
+package limiters
+
+import (
+	"time"
+
+	rate_limiter "github.com/krishpatel023/ratelimiter/internal/rate-limiter"
+)
+
+// Rule is one of several limits every key is held to at the same time
+// A plan of 5 requests per second, 1,000 per hour and 20,000 per day is three rules:
+//
+//	config.Rules = []limiters.Rule{
+//		{Name: "second", Capacity: 5, RefillRate: 5},
+//		{Name: "hour", Capacity: 1000, Algorithm: limiters.FixedWindow, WindowUnit: limiters.WindowHour},
+//		{Name: "day", Capacity: 20000, Algorithm: limiters.FixedWindow, WindowUnit: limiters.WindowDay},
+//	}
+//
+// A request is allowed only if every rule has room for it, and a rejected request is not
+// counted by any of the rules
+type Rule = rate_limiter.Rule
+
+// rulesCapacity returns the capacity of the tightest rule - no request can cost more
+func rulesCapacity(rules []Rule) int {
+	capacity := rules[0].Capacity
+	for _, rule := range rules[1:] {
+		capacity = min(capacity, rule.Capacity)
+	}
+	return capacity
+}
+
+// rulesRetryInterval returns how often a queued request retries its rules - as often as the fastest rule frees up room
+func rulesRetryInterval(rules []Rule) time.Duration {
+	interval := time.Second
+	for _, rule := range rules {
+		interval = min(interval, queueRetryInterval(rule.Algorithm, rule.Capacity, rule.RefillRate, rule.Window))
+	}
+	return interval
+}
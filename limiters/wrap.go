@@ -0,0 +1,48 @@
+package limiters
+
+import (
+	"net/http"
+)
+
+// LocalMiddleware returns a standard middleware that rate limits the requests with the local rate limiter
+// and hands the allowed ones to the next handler, for http.ServeMux, chi, gorilla/mux and any other
+// middleware chain:
+//
+//	limit, err := limiters.LocalMiddleware(rl, config)
+//	mux.Handle("GET /search", limit(searchHandler))
+//
+// TargetURL is not used. Several middlewares can share one rate limiter, e.g. one per route with its
+// own limits - give each its own Namespace so they do not share buckets. Any Limiter can be used
+func LocalMiddleware(rl Limiter, config LocalRateLimiterConfig) (func(http.Handler) http.Handler, error) {
+	settings, err := config.middlewareSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := bindLimiter(rl, settings)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		return rateLimitHandler(backend, settings, next)
+	}, nil
+}
+
+// DistributedMiddleware returns a standard middleware that rate limits the requests with the distributed
+// rate limiter and hands the allowed ones to the next handler, like LocalMiddleware
+// TargetURL is not used, and middlewares sharing the rate limiter need their own Namespace to keep their
+// buckets apart
+func DistributedMiddleware(rl Limiter, config DistributedRateLimiterConfig) (func(http.Handler) http.Handler, error) {
+	settings, err := config.middlewareSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := bindLimiter(rl, settings)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		return rateLimitHandler(backend, settings, next)
+	}, nil
+}
@@ -7,12 +7,20 @@ import (
 	"github.com/krishpatel023/ratelimiter/limiters"
 )
 
+// Limiter is implemented by both rate limiters - the middlewares accept any Limiter,
+// so code written against it can swap the local and the distributed backend
+type Limiter = limiters.Limiter
+
+// Decision is the outcome of Limiter.Allow along with the state of the bucket
+type Decision = limiters.Decision
+
 type LocalWrapper struct {
 	Config                 limiters.LocalRateLimiterConfig
 	New                    func(config limiters.LocalRateLimiterConfig) (*rate_limiter.LocalRateLimiter, error)
 	Stop                   func(rl *rate_limiter.LocalRateLimiter)
-	MiddlewareWithoutProxy func(rl *rate_limiter.LocalRateLimiter, config limiters.LocalRateLimiterConfig) http.Handler
-	Middleware             func(rl *rate_limiter.LocalRateLimiter, config limiters.LocalRateLimiterConfig) http.Handler
+	MiddlewareWithoutProxy func(rl limiters.Limiter, config limiters.LocalRateLimiterConfig) (http.Handler, error)
+	Middleware             func(rl limiters.Limiter, config limiters.LocalRateLimiterConfig) (http.Handler, error)
+	Wrap                   func(rl limiters.Limiter, config limiters.LocalRateLimiterConfig) (func(http.Handler) http.Handler, error)
 }
 
 var Local = LocalWrapper{
@@ -21,14 +29,16 @@ var Local = LocalWrapper{
 	Stop:                   limiters.StopLocalRateLimiter,
 	MiddlewareWithoutProxy: limiters.LocalNonProxyRateLimitingMiddleware,
 	Middleware:             limiters.LocalRateLimitingMiddleware,
+	Wrap:                   limiters.LocalMiddleware,
 }
 
 type DistributedWrapper struct {
 	Config                 limiters.DistributedRateLimiterConfig
 	New                    func(config limiters.DistributedRateLimiterConfig) (*rate_limiter.DistributedRateLimiter, error)
 	Stop                   func(rl *rate_limiter.DistributedRateLimiter)
-	Middleware             func(rl *rate_limiter.DistributedRateLimiter, config limiters.DistributedRateLimiterConfig) http.Handler
-	MiddlewareWithoutProxy func(rl *rate_limiter.DistributedRateLimiter, config limiters.DistributedRateLimiterConfig) http.Handler
+	Middleware             func(rl limiters.Limiter, config limiters.DistributedRateLimiterConfig) (http.Handler, error)
+	MiddlewareWithoutProxy func(rl limiters.Limiter, config limiters.DistributedRateLimiterConfig) (http.Handler, error)
+	Wrap                   func(rl limiters.Limiter, config limiters.DistributedRateLimiterConfig) (func(http.Handler) http.Handler, error)
 }
 
 var Distributed = DistributedWrapper{
@@ -37,4 +47,5 @@ var Distributed = DistributedWrapper{
 	Stop:                   limiters.StopDistributedRateLimiter,
 	MiddlewareWithoutProxy: limiters.DistributedNonProxyRateLimitingMiddleware,
 	Middleware:             limiters.DistributedRateLimitingMiddleware,
+	Wrap:                   limiters.DistributedMiddleware,
 }